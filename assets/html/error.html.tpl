@@ -36,6 +36,7 @@
         <div class="column">
             <h1 class="ui header">{{.StatusCode}}</h1>
             <h2  class="ui header">{{.Message}}</h2>
+            {{if .TraceID}}<p class="ui grey text">Trace ID: <code>{{.TraceID}}</code></p>{{end}}
             <p>
                 <a class="ui labeled icon button blue" href="/">
                     <i class="angle double up icon"></i>
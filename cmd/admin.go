@@ -0,0 +1,95 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"net/url"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/health"
+	"github.com/uzuna/go-authproxy/metrics"
+	"github.com/uzuna/go-authproxy/oidc"
+)
+
+// Build information. These are set by -ldflags "-X main.version=..."
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildDate = ""
+)
+
+// mountAdmin mounts health, build-info and metrics endpoints
+func mountAdmin(r chi.Router, hc *health.Health) {
+	r.Method("GET", "/healthz", hc.Liveness())
+	r.Method("GET", "/readyz", hc.Readiness())
+	r.Method("GET", "/buildinfo", health.BuildInfoHandler(health.BuildInfo{
+		Version:   version,
+		Commit:    commit,
+		BuildDate: buildDate,
+	}))
+	r.Method("GET", "/metrics", metrics.Handler())
+}
+
+// lazyHandler responds 503 until handler is set.
+// Admin listener starts before the proxy is built.
+type lazyHandler struct {
+	h atomic.Value
+}
+
+func (l *lazyHandler) Set(h http.Handler) {
+	l.h.Store(h)
+}
+
+func (l *lazyHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h, ok := l.h.Load().(http.Handler)
+	if !ok {
+		http.Error(w, "Not ready", http.StatusServiceUnavailable)
+		return
+	}
+	h.ServeHTTP(w, r)
+}
+
+// upstreamCheck checks upstream by health path or tcp connection
+func upstreamCheck(u *url.URL, path string) health.Check {
+	if len(path) > 0 {
+		hu := *u
+		hu.Path = path
+		hu.RawQuery = ""
+		return health.HTTPCheck(hu.String())
+	}
+	host := u.Host
+	if len(u.Port()) < 1 {
+		port := "80"
+		if u.Scheme == "https" {
+			port = "443"
+		}
+		host = net.JoinHostPort(u.Hostname(), port)
+	}
+	return health.TCPCheck(host)
+}
+
+// newAuthenticator retries to fetch JWKS until success.
+// Readiness check of "jwks" passes after loaded.
+func newAuthenticator(ctx context.Context, c *oidc.Config, hc *health.Health) (oidc.Authenticator, error) {
+	flag := &health.Flag{}
+	hc.Add("jwks", flag.Check)
+	for {
+		auth, err := oidc.NewAuthenticator(c)
+		if err == nil {
+			flag.Set()
+			return auth, nil
+		}
+		flag.Fail(errors.Wrap(err, "JWKS is not loaded"))
+		logrus.Warnf("Fail load JWKS. retry after 5s: %s", err)
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-time.After(time.Second * 5):
+		}
+	}
+}
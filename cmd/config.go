@@ -1,29 +1,420 @@
 package main
 
 import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gorilla/securecookie"
 	"github.com/joho/godotenv"
 	"github.com/kelseyhightower/envconfig"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/router"
+	"github.com/uzuna/go-authproxy/secret"
+	"github.com/uzuna/go-authproxy/tracing"
+	"gopkg.in/yaml.v2"
+	yaml3 "gopkg.in/yaml.v3"
+)
+
+// ConfigVersion is current version of config schema
+const ConfigVersion = 1
+
+// default values of Config
+const (
+	defaultConfigFile   = "./config.yml"
+	defaultPort         = 8080
+	defaultSessionName  = "demo"
+	defaultAcceptOrigin = `^https?://localhost`
 )
 
+// Config is schema of config file.
+// Routes and policies of ProxyConfig are on top level.
 type Config struct {
-	Port            int    `default:8080`
-	ForwardTo       string `required:"true"`
-	AcceptOriginPtn string `required:"true" default:"^https?\:\/{2}localhost"`
-	AuthConfigFile  string `default:"./config.yml"`
-	SessionName     string `default:"demo"`
-	CertFile        string
-	KeyFile         string
+	// Version is version of the schema. File without version is legacy format.
+	Version int `yaml:"version"`
+	// Listen is listeners of the proxy
+	Listen ListenConfig `yaml:"listen"`
+	// Upstream is backend of the proxy
+	Upstream UpstreamConfig `yaml:"upstream"`
+	// Provider is OpenID Provider and the client
+	Provider oidc.Config `yaml:"provider"`
+	// SessionKeys sign and encrypt session cookie.
+	// The first encodes and all decode for rotation. Random keys are used when empty.
+	SessionKeys []SessionKey `yaml:"session_keys"`
+
+	Proxy ProxyConfig `yaml:",inline"`
+}
+
+// ListenConfig is listeners of the proxy
+type ListenConfig struct {
+	// Port of the proxy. default is 8080
+	Port int `yaml:"port"`
+	// AdminPort serves health, build-info, metrics and session admin API on separated listener.
+	// These are not served when 0 except PublicAdmin.
+	AdminPort int `yaml:"admin_port"`
+	// PublicAdmin serves health, build-info and metrics on Port without AdminPort
+	PublicAdmin bool `yaml:"public_admin"`
+	// CertFile and KeyFile enable TLS of Port
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+}
+
+// UpstreamConfig is backend of the proxy
+type UpstreamConfig struct {
+	// URL of upstream
+	URL string `yaml:"url"`
+	// HealthPath is checked by readiness. tcp connection is checked when empty.
+	HealthPath string `yaml:"health_path"`
+}
+
+// SessionKey is pair of keys of session cookie
+type SessionKey struct {
+	// Auth is key of HMAC. 32 or 64 bytes are recommended
+	Auth secret.Value `yaml:"auth"`
+	// Encryption is key of AES in 16, 24 or 32 bytes. Empty disables encryption.
+	Encryption secret.Value `yaml:"encryption"`
 }
 
-func loadConfig() (*Config, error) {
+// ProxyConfig is routes and policies of the proxy
+type ProxyConfig struct {
+	// AcceptOrigin is pattern of Referer to return after login. default is "^https?://localhost"
+	AcceptOrigin string `yaml:"accept_origin"`
+	// Headers maps claims of ID token to request header of upstream
+	Headers []router.AdditionalHeader `yaml:"headers"`
+	// IdentityHeaders are removed from every incoming request.
+	// Authorization and names of Headers are always removed.
+	IdentityHeaders []string `yaml:"identity_headers"`
+	// TrustedProxies is list of CIDR of load balancers.
+	// Client ip and scheme from X-Forwarded-* or Forwarded are honoured
+	// only when they come from these.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+	// Tracing is exporter setting of OpenTelemetry
+	Tracing tracing.Config `yaml:"tracing"`
+	// Audit is output setting of audit log of security events
+	Audit logging.AuditConfig `yaml:"audit"`
+	// UserInfoRefresh is interval to refetch userinfo. 0 disables refresh.
+	UserInfoRefresh time.Duration `yaml:"userinfo_refresh"`
+	// Me is setting of session introspection endpoint "/.auth/me"
+	Me router.MeConfig `yaml:"me"`
+	// Cookie is name and attributes of session cookie
+	Cookie session.CookieConfig `yaml:"cookie"`
+	// CSRF is protection of unsafe methods on authenticated routes
+	CSRF router.CSRFConfig `yaml:"csrf"`
+	// CallbackOrigins are accepted Origin of form_post callback.
+	// Origin of auth_url is always accepted.
+	CallbackOrigins []string `yaml:"callback_origins"`
+	// Session limits lifetime of session independent of token expiry
+	Session router.SessionPolicy `yaml:"session"`
+	// SensitiveRoutes require recent authentication to the provider
+	SensitiveRoutes []SensitiveRoute `yaml:"sensitive_routes"`
+	// Admin is policy of session admin API on admin listener
+	Admin router.AdminConfig `yaml:"admin"`
+	// RateLimits limit requests by client ip or user per path prefix
+	RateLimits []router.RateLimitRule `yaml:"rate_limits"`
+	// BearerTokens accepts ID token in Authorization header without session.
+	// e.g. the token obtained by login subcommand
+	BearerTokens bool `yaml:"bearer_tokens"`
+}
+
+// SensitiveRoute requires authentication within MaxAge
+type SensitiveRoute struct {
+	Path   string        `yaml:"path"`
+	MaxAge time.Duration `yaml:"max_age"`
+}
+
+// configPath returns path of config file from APX_CONFIG or legacy APX_AUTHCONFIGFILE
+func configPath() string {
+	for _, k := range []string{"APX_CONFIG", "APX_AUTHCONFIGFILE"} {
+		if v := os.Getenv(k); len(v) > 0 {
+			return v
+		}
+	}
+	return defaultConfigFile
+}
+
+// loadConfig reads, expands and validates config file and resolves secrets
+func loadConfig(path string) (*Config, error) {
 	godotenv.Load()
 
-	var c Config
-	err := envconfig.Process("apx", &c)
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c, err := parseConfig(b)
+	if err != nil {
+		return nil, errors.Wrapf(err, "%s", path)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), secretTimeout)
+	defer cancel()
+	errs := c.resolveSecrets(ctx)
+	if err := c.Validate(); err != nil {
+		errs = append(errs, err.(ValidationError)...)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Wrapf(errs, "%s", path)
+	}
+	return c, nil
+}
+
+// secretTimeout is limit to resolve all secrets
+const secretTimeout = time.Second * 30
 
+// resolveSecrets replaces references of secrets with the values
+func (c *Config) resolveSecrets(ctx context.Context) ValidationError {
+	v := &validator{}
+	resolve := func(path string, s *secret.Value) {
+		if len(*s) < 1 {
+			return
+		}
+		if !secret.IsRef(string(*s)) {
+			logrus.Warnf("%s is plain text. Use file:, env: or exec: reference", path)
+			return
+		}
+		x, err := secret.Resolve(ctx, string(*s))
+		if err != nil {
+			v.errorf(path, "%s", err)
+			return
+		}
+		*s = x
+	}
+	resolve("provider.client_secret", &c.Provider.ClientSecret)
+	for i := range c.SessionKeys {
+		resolve(fmt.Sprintf("session_keys[%d].auth", i), &c.SessionKeys[i].Auth)
+		resolve(fmt.Sprintf("session_keys[%d].encryption", i), &c.SessionKeys[i].Encryption)
+	}
+	return v.errs
+}
+
+// sessionKeyPairs returns keys for session.KeyRing
+func (c *Config) sessionKeyPairs() [][]byte {
+	var pairs [][]byte
+	for _, v := range c.SessionKeys {
+		var block []byte
+		if len(v.Encryption) > 0 {
+			block = []byte(v.Encryption)
+		}
+		pairs = append(pairs, []byte(v.Auth), block)
+	}
+	return pairs
+}
+
+// parseConfig parses config file and sets default values
+func parseConfig(b []byte) (*Config, error) {
+	b, err := expandEnv(b)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	return &c, nil
+	var v struct {
+		Version int `yaml:"version"`
+	}
+	if err := yaml.Unmarshal(b, &v); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var c *Config
+	if v.Version == 0 {
+		logrus.Warnf("Config without version is deprecated. Please migrate to version %d", ConfigVersion)
+		c, err = parseLegacyConfig(b)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+	} else {
+		c = &Config{}
+		if err := yaml.UnmarshalStrict(b, c); err != nil {
+			return nil, errors.WithStack(err)
+		}
+	}
+	c.setDefaults()
+	return c, nil
+}
+
+func (c *Config) setDefaults() {
+	if c.Listen.Port == 0 {
+		c.Listen.Port = defaultPort
+	}
+	if len(c.Proxy.Cookie.Name) < 1 {
+		c.Proxy.Cookie.Name = defaultSessionName
+	}
+	if len(c.Proxy.AcceptOrigin) < 1 {
+		c.Proxy.AcceptOrigin = defaultAcceptOrigin
+	}
+}
+
+// legacyEnv is settings by environment variables of legacy format
+type legacyEnv struct {
+	Port               int
+	ForwardTo          string
+	AcceptOriginPtn    string
+	SessionName        string
+	CertFile           string
+	KeyFile            string
+	AdminPort          int
+	UpstreamHealthPath string
+}
+
+// parseLegacyConfig reads config file which has provider and proxy settings
+// on top level and listeners from APX_* environment variables
+func parseLegacyConfig(b []byte) (*Config, error) {
+	var env legacyEnv
+	if err := envconfig.Process("apx", &env); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c := &Config{
+		Version: ConfigVersion,
+		Listen: ListenConfig{
+			Port:      env.Port,
+			AdminPort: env.AdminPort,
+			CertFile:  env.CertFile,
+			KeyFile:   env.KeyFile,
+		},
+		Upstream: UpstreamConfig{
+			URL:        env.ForwardTo,
+			HealthPath: env.UpstreamHealthPath,
+		},
+	}
+	if err := yaml.Unmarshal(b, &c.Provider); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := yaml.Unmarshal(b, &c.Proxy); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if len(env.AcceptOriginPtn) > 0 {
+		c.Proxy.AcceptOrigin = env.AcceptOriginPtn
+	}
+	if len(env.SessionName) > 0 {
+		c.Proxy.Cookie.Name = env.SessionName
+	}
+	return c, nil
+}
+
+// reEnvRef matches ${NAME} and escaped $${NAME}
+var reEnvRef = regexp.MustCompile(`\$?\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// expandEnv replaces ${NAME} in scalar values with environment variable.
+// Content of file of NAME_FILE is used when NAME is not set.
+// $${NAME} is left as ${NAME}. Keys and comments are not expanded.
+// Values are replaced after parsing so that they can not change structure of the document.
+func expandEnv(b []byte) ([]byte, error) {
+	var doc yaml3.Node
+	if err := yaml3.Unmarshal(b, &doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if doc.Kind == 0 {
+		// empty document
+		return b, nil
+	}
+	if err := expandNode(&doc); err != nil {
+		return nil, err
+	}
+	var buf bytes.Buffer
+	enc := yaml3.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(&doc); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return buf.Bytes(), nil
+}
+
+// expandNode expands scalar values under the node
+func expandNode(n *yaml3.Node) error {
+	switch n.Kind {
+	case yaml3.ScalarNode:
+		return expandScalar(n)
+	case yaml3.MappingNode:
+		// skip keys
+		for i := 1; i < len(n.Content); i += 2 {
+			if err := expandNode(n.Content[i]); err != nil {
+				return err
+			}
+		}
+	default:
+		for _, v := range n.Content {
+			if err := expandNode(v); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func expandScalar(n *yaml3.Node) error {
+	if !strings.Contains(n.Value, "${") {
+		return nil
+	}
+	var lerr error
+	v := reEnvRef.ReplaceAllStringFunc(n.Value, func(m string) string {
+		if strings.HasPrefix(m, "$$") {
+			return m[1:]
+		}
+		name := reEnvRef.FindStringSubmatch(m)[1]
+		v, err := lookupEnv(name)
+		if err != nil && lerr == nil {
+			lerr = errors.Wrapf(err, "line %d", n.Line)
+		}
+		return v
+	})
+	if lerr != nil {
+		return lerr
+	}
+	n.Value = v
+	if n.Style&(yaml3.SingleQuotedStyle|yaml3.DoubleQuotedStyle|yaml3.LiteralStyle|yaml3.FoldedStyle) == 0 {
+		// plain value is resolved again like written in the file. e.g. port: ${PORT}
+		// the encoder quotes it when it can not be a plain scalar
+		n.Tag = ""
+	}
+	return nil
+}
+
+// lookupEnv returns value of NAME or content of file at NAME_FILE
+func lookupEnv(name string) (string, error) {
+	if v, ok := os.LookupEnv(name); ok {
+		return v, nil
+	}
+	if path, ok := os.LookupEnv(name + "_FILE"); ok {
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.Wrapf(err, "${%s}", name)
+		}
+		return strings.TrimRight(string(b), "\r\n"), nil
+	}
+	return "", errors.Errorf("${%s} is not set", name)
+}
+
+// newKeyRing creates keys of session cookie.
+// Random keys are generated when session_keys is empty.
+func newKeyRing(c *Config) (*session.KeyRing, error) {
+	pairs := c.sessionKeyPairs()
+	if len(pairs) < 1 {
+		logrus.Info("session_keys is not set. Random keys are used")
+		pairs = [][]byte{securecookie.GenerateRandomKey(64), securecookie.GenerateRandomKey(32)}
+	}
+	return session.NewKeyRing(pairs...)
+}
+
+// reloadSecrets resolves secrets of config file again and replaces
+// session keys and client_secret. Other settings require restart.
+func reloadSecrets(path string, keys *session.KeyRing, auth oidc.ClientSecretSetter) error {
+	c, err := loadConfig(path)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if pairs := c.sessionKeyPairs(); len(pairs) > 0 {
+		if err := keys.SetKeys(pairs...); err != nil {
+			return errors.WithStack(err)
+		}
+		logrus.Info("Session keys are reloaded")
+	}
+	if auth != nil {
+		auth.SetClientSecret(c.Provider.ClientSecret)
+		logrus.Info("client_secret is reloaded")
+	}
+	return nil
 }
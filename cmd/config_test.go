@@ -0,0 +1,330 @@
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/ratelimit"
+	"github.com/uzuna/go-authproxy/router"
+	"github.com/uzuna/go-authproxy/secret"
+	"gopkg.in/yaml.v2"
+)
+
+const testConfig = `
+version: 1
+listen:
+  port: 8989
+  admin_port: 9090
+upstream:
+  url: http://localhost:8080
+provider:
+  client_id: ${TEST_APX_CLIENT_ID}
+  client_secret: "${TEST_APX_CLIENT_SECRET}"
+  endpoint:
+    auth_url: https://idp.example.com/authorize
+  redirect_url: /cb
+  scopes: [openid]
+  jwk_url: https://idp.example.com/keys
+  response_type: id_token
+# ${NOT_EXPANDED} in comment
+accept_origin: "^https://app\\.example\\.com$"
+headers:
+  - claim: preferred_username
+    header: X-Username
+session:
+  idle_timeout: 30m
+rate_limits:
+  - path: /login
+    key: ip
+    requests: 10
+    per: 1m
+`
+
+func TestParseConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authproxy")
+	checkError(t, err)
+	defer os.RemoveAll(dir)
+	secret := filepath.Join(dir, "secret")
+	checkError(t, ioutil.WriteFile(secret, []byte("s3cr$t\n"), 0600))
+
+	os.Setenv("TEST_APX_CLIENT_ID", "client-1")
+	os.Setenv("TEST_APX_CLIENT_SECRET_FILE", secret)
+	defer os.Unsetenv("TEST_APX_CLIENT_ID")
+	defer os.Unsetenv("TEST_APX_CLIENT_SECRET_FILE")
+
+	c, err := parseConfig([]byte(testConfig))
+	checkError(t, err)
+	checkError(t, c.Validate())
+	assert.Equal(t, 8989, c.Listen.Port)
+	assert.Equal(t, "client-1", c.Provider.ClientID)
+	assert.Equal(t, "s3cr$t", string(c.Provider.ClientSecret))
+	assert.Equal(t, `^https://app\.example\.com$`, c.Proxy.AcceptOrigin)
+	assert.Equal(t, time.Minute*30, c.Proxy.Session.IdleTimeout)
+	assert.Equal(t, "demo", c.Proxy.Cookie.Name)
+	assert.Nil(t, c.Provider.Leeway)
+
+	// zero leeway is kept to disable clock difference
+	lc, err := parseConfig([]byte("version: 1\nprovider:\n  leeway: 0s\n"))
+	checkError(t, err)
+	if assert.NotNil(t, lc.Provider.Leeway) {
+		assert.Equal(t, time.Duration(0), *lc.Provider.Leeway)
+	}
+
+	// unset variable
+	os.Unsetenv("TEST_APX_CLIENT_ID")
+	_, err = parseConfig([]byte(testConfig))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 9: ${TEST_APX_CLIENT_ID} is not set")
+
+	// unknown field
+	_, err = parseConfig([]byte("version: 1\nlisten:\n  prot: 80\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "prot")
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("TEST_APX_NAME", "x")
+	os.Setenv("TEST_APX_PORT", "8989")
+	os.Setenv("TEST_APX_TRICKY", "a: b # c\nupstream:\n  url: http://evil")
+	defer os.Unsetenv("TEST_APX_NAME")
+	defer os.Unsetenv("TEST_APX_PORT")
+	defer os.Unsetenv("TEST_APX_TRICKY")
+	b, err := expandEnv([]byte(`a: ${TEST_APX_NAME}
+b: $${TEST_APX_NAME}
+c: $TEST_APX_NAME
+d: "${TEST_APX_NAME}-y"
+port: ${TEST_APX_PORT} # ${TEST_APX_UNSET} in comment
+tricky: ${TEST_APX_TRICKY}
+`))
+	checkError(t, err)
+	var m map[string]interface{}
+	checkError(t, yaml.Unmarshal(b, &m))
+	assert.Equal(t, map[string]interface{}{
+		"a":    "x",
+		"b":    "${TEST_APX_NAME}",
+		"c":    "$TEST_APX_NAME",
+		"d":    "x-y",
+		"port": 8989,
+		// value can not change structure of the document
+		"tricky": "a: b # c\nupstream:\n  url: http://evil",
+	}, m)
+
+	_, err = expandEnv([]byte("a: 1\nb: ${TEST_APX_UNSET}\n"))
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "line 2: ${TEST_APX_UNSET} is not set")
+}
+
+func TestParseLegacyConfig(t *testing.T) {
+	os.Setenv("APX_PORT", "8989")
+	os.Setenv("APX_FORWARDTO", "http://localhost:8080")
+	os.Setenv("APX_SESSIONNAME", "legacy")
+	defer os.Unsetenv("APX_PORT")
+	defer os.Unsetenv("APX_FORWARDTO")
+	defer os.Unsetenv("APX_SESSIONNAME")
+
+	c, err := parseConfig([]byte(`
+client_id: client-1
+endpoint:
+  auth_url: https://idp.example.com/authorize
+redirect_url: /cb
+scopes: [openid]
+jwk_url: https://idp.example.com/keys
+response_type: id_token
+headers:
+  - claim: email
+    header: X-Email
+`))
+	checkError(t, err)
+	checkError(t, c.Validate())
+	assert.Equal(t, ConfigVersion, c.Version)
+	assert.Equal(t, 8989, c.Listen.Port)
+	assert.Equal(t, "http://localhost:8080", c.Upstream.URL)
+	assert.Equal(t, "client-1", c.Provider.ClientID)
+	assert.Equal(t, "legacy", c.Proxy.Cookie.Name)
+	assert.Equal(t, "X-Email", c.Proxy.Headers[0].HeaderName)
+	assert.Equal(t, defaultAcceptOrigin, c.Proxy.AcceptOrigin)
+}
+
+func TestValidate(t *testing.T) {
+	valid := func() *Config {
+		c := &Config{Version: ConfigVersion}
+		c.Upstream.URL = "http://localhost:8080"
+		c.Provider.ClientID = "client-1"
+		c.Provider.Endpoint.AuthURL = "https://idp.example.com/authorize"
+		c.Provider.JWKURL = "https://idp.example.com/keys"
+		c.Provider.RedirectURL = "/cb"
+		c.Provider.ResponseType = "id_token"
+		c.Provider.Scopes = []string{"openid"}
+		c.setDefaults()
+		return c
+	}
+	checkError(t, valid().Validate())
+
+	testset := []struct {
+		path   string
+		modify func(c *Config)
+	}{
+		{"version", func(c *Config) { c.Version = 2 }},
+		{"listen.port", func(c *Config) { c.Listen.Port = 70000 }},
+		{"listen.admin_port", func(c *Config) { c.Listen.AdminPort = c.Listen.Port }},
+		{"listen.public_admin", func(c *Config) { c.Listen.AdminPort = 9090; c.Listen.PublicAdmin = true }},
+		{"listen", func(c *Config) { c.Listen.CertFile = "cert.pem" }},
+		{"upstream.url", func(c *Config) { c.Upstream.URL = "" }},
+		{"upstream.url", func(c *Config) { c.Upstream.URL = "localhost:8080" }},
+		{"provider.client_id", func(c *Config) { c.Provider.ClientID = "" }},
+		{"provider.jwk_url", func(c *Config) { c.Provider.JWKURL = "" }},
+		{"provider.redirect_url", func(c *Config) { c.Provider.RedirectURL = "cb" }},
+		{"provider.response_type", func(c *Config) { c.Provider.ResponseType = "code" }},
+		{"provider.scopes", func(c *Config) { c.Provider.Scopes = []string{"email"} }},
+		{"provider.issuers[0]", func(c *Config) { c.Provider.Issuers = []string{"issuer"} }},
+		{"provider.leeway", func(c *Config) { d := -time.Second; c.Provider.Leeway = &d }},
+		{"provider.client_ids[1]", func(c *Config) { c.Provider.ClientIDs = []string{"cli", ""} }},
+		{"provider.checks.tenants", func(c *Config) { c.Provider.Checks.TenantClaim = "org" }},
+		{"accept_origin", func(c *Config) { c.Proxy.AcceptOrigin = "(" }},
+		{"headers[0]", func(c *Config) { c.Proxy.Headers = []router.AdditionalHeader{{ClaimKey: "email"}} }},
+		{"trusted_proxies[1]", func(c *Config) { c.Proxy.TrustedProxies = []string{"10.0.0.0/8", "10.0.0"} }},
+		{"cookie.same_site", func(c *Config) { c.Proxy.Cookie.SameSite = "none" }},
+		{"csrf.mode", func(c *Config) { c.Proxy.CSRF.Mode = "token" }},
+		{"callback_origins[0]", func(c *Config) { c.Proxy.CallbackOrigins = []string{"idp.example.com"} }},
+		{"session.on_limit", func(c *Config) { c.Proxy.Session.OnLimit = "drop" }},
+		{"session.idle_timeout", func(c *Config) { c.Proxy.Session.IdleTimeout = -1 }},
+		{"sensitive_routes[0].max_age", func(c *Config) { c.Proxy.SensitiveRoutes = []SensitiveRoute{{Path: "/admin"}} }},
+		{"admin.values", func(c *Config) { c.Proxy.Admin.Claim = "groups" }},
+		{"rate_limits[0].key", func(c *Config) {
+			c.Proxy.RateLimits = []router.RateLimitRule{{Path: "/", Key: "user", Limit: ratelimit.Limit{Requests: 1, Per: time.Second}}}
+		}},
+	}
+	for _, v := range testset {
+		c := valid()
+		v.modify(c)
+		verr, ok := errors.Cause(c.Validate()).(ValidationError)
+		if !assert.True(t, ok, v.path) {
+			continue
+		}
+		var paths []string
+		for _, e := range verr {
+			paths = append(paths, e.Path)
+		}
+		assert.Contains(t, paths, v.path)
+	}
+}
+
+func TestCheckConfig(t *testing.T) {
+	f, err := ioutil.TempFile("", "authproxy")
+	checkError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("version: 1\nupstream:\n  url: localhost\n")
+	f.Close()
+
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 1, checkConfig(&stdout, &stderr, f.Name(), false))
+	lines := strings.Split(strings.TrimSpace(stderr.String()), "\n")
+	assert.Contains(t, lines, f.Name()+": upstream.url: must be absolute http(s) URL [localhost]")
+	assert.Contains(t, lines, f.Name()+": provider.client_id: is required")
+}
+
+func TestSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authproxy")
+	checkError(t, err)
+	defer os.RemoveAll(dir)
+	write := func(name, content string) string {
+		p := filepath.Join(dir, name)
+		checkError(t, ioutil.WriteFile(p, []byte(content), 0600))
+		return p
+	}
+	hashKey := strings.Repeat("h", 64)
+	write("hash", hashKey+"\n")
+	os.Setenv("TEST_APX_BLOCK_KEY", strings.Repeat("b", 32))
+	defer os.Unsetenv("TEST_APX_BLOCK_KEY")
+	path := write("config.yml", `
+version: 1
+upstream:
+  url: http://localhost:8080
+provider:
+  client_id: client-1
+  client_secret: "exec:echo client-s3cret"
+  endpoint:
+    auth_url: https://idp.example.com/authorize
+  redirect_url: /cb
+  scopes: [openid]
+  jwk_url: https://idp.example.com/keys
+  response_type: id_token
+session_keys:
+  - auth: file:`+filepath.Join(dir, "hash")+`
+    encryption: env:TEST_APX_BLOCK_KEY
+`)
+
+	c, err := loadConfig(path)
+	checkError(t, err)
+	assert.Equal(t, "client-s3cret", string(c.Provider.ClientSecret))
+	assert.Equal(t, [][]byte{[]byte(hashKey), []byte(strings.Repeat("b", 32))}, c.sessionKeyPairs())
+	_, err = newKeyRing(c)
+	checkError(t, err)
+
+	// secrets are redacted in dump
+	var stdout, stderr bytes.Buffer
+	assert.Equal(t, 0, checkConfig(&stdout, &stderr, path, true))
+	assert.NotContains(t, stdout.String(), "client-s3cret")
+	assert.NotContains(t, stdout.String(), hashKey)
+	assert.Contains(t, stdout.String(), "client_secret: '[REDACTED]'")
+
+	// errors show path without secret
+	os.Setenv("TEST_APX_BLOCK_KEY", "short-s3cret")
+	stdout.Reset()
+	stderr.Reset()
+	assert.Equal(t, 1, checkConfig(&stdout, &stderr, path, false))
+	assert.Contains(t, stderr.String(), "session_keys[0].encryption: must be 16, 24 or 32 bytes but 12 bytes")
+	assert.NotContains(t, stderr.String(), "short-s3cret")
+	os.Unsetenv("TEST_APX_BLOCK_KEY")
+	stderr.Reset()
+	assert.Equal(t, 1, checkConfig(&stdout, &stderr, path, false))
+	assert.Contains(t, stderr.String(), "session_keys[0].encryption: Environment variable [TEST_APX_BLOCK_KEY] is not set")
+}
+
+type secretRecorder struct {
+	v secret.Value
+}
+
+func (s *secretRecorder) SetClientSecret(v secret.Value) {
+	s.v = v
+}
+
+func TestReloadSecrets(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authproxy")
+	checkError(t, err)
+	defer os.RemoveAll(dir)
+	client := filepath.Join(dir, "client")
+	checkError(t, ioutil.WriteFile(client, []byte("s3cret-1\n"), 0600))
+	path := filepath.Join(dir, "config.yml")
+	checkError(t, ioutil.WriteFile(path, []byte(`
+version: 1
+upstream:
+  url: http://localhost:8080
+provider:
+  client_id: client-1
+  client_secret: file:`+client+`
+  endpoint:
+    auth_url: https://idp.example.com/authorize
+  redirect_url: /cb
+  scopes: [openid]
+  jwk_url: https://idp.example.com/keys
+  response_type: id_token
+`), 0600))
+	c, err := loadConfig(path)
+	checkError(t, err)
+	keys, err := newKeyRing(c)
+	checkError(t, err)
+
+	// rotated client_secret is applied on reload
+	checkError(t, ioutil.WriteFile(client, []byte("s3cret-2\n"), 0600))
+	auth := &secretRecorder{}
+	checkError(t, reloadSecrets(path, keys, auth))
+	assert.Equal(t, secret.Value("s3cret-2"), auth.v)
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+const configUsage = `Usage: authproxy config check [-config path] [-print]
+
+Subcommands:
+  check  validate config file. exit status is 1 when invalid.
+         -print shows resolved config with redacted secrets
+`
+
+// runConfig runs config subcommands and returns exit status
+func runConfig(args []string) int {
+	if len(args) < 1 || args[0] != "check" {
+		fmt.Fprint(os.Stderr, configUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("config check", flag.ExitOnError)
+	path := fs.String("config", configPath(), "path of config file")
+	print := fs.Bool("print", false, "print resolved config. secrets are redacted")
+	fs.Parse(args[1:])
+	return checkConfig(os.Stdout, os.Stderr, *path, *print)
+}
+
+// checkConfig prints each invalid value of config file
+func checkConfig(stdout, stderr io.Writer, path string, print bool) int {
+	c, err := loadConfig(path)
+	if err == nil {
+		if print {
+			b, err := yaml.Marshal(c)
+			if err != nil {
+				fmt.Fprintf(stderr, "%s\n", err)
+				return 1
+			}
+			stdout.Write(b)
+		}
+		fmt.Fprintf(stderr, "%s: OK\n", path)
+		return 0
+	}
+	if verr, ok := errors.Cause(err).(ValidationError); ok {
+		for _, v := range verr {
+			fmt.Fprintf(stderr, "%s: %s\n", path, v)
+		}
+		return 1
+	}
+	fmt.Fprintf(stderr, "%s\n", err)
+	return 1
+}
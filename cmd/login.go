@@ -0,0 +1,373 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/skratchdot/open-golang/open"
+	"github.com/uzuna/go-authproxy/oidc"
+)
+
+const loginUsage = `Usage: authproxy login [flags] [get|store|erase]
+
+Login to the provider of config with browser and print ID token.
+The token is cached until expiry. Register redirect_uri
+"http://127.0.0.1/callback" with any port as public client to the provider.
+-device uses device authorization grant for terminals without browser.
+It shows URL and code to enter on another device.
+
+Output:
+  token    ID token (default)
+  json     id_token and expiry as JSON
+  kubectl  ExecCredential of client-go credential plugin
+  git      git credential helper with authtype Bearer (git 2.46 or later).
+           get, store and erase are actions given by git
+
+Flags:
+`
+
+// loginTimeout is time to wait for the callback
+const loginTimeout = time.Minute * 5
+
+// loginExpiryMargin is remaining lifetime to reuse cached token
+const loginExpiryMargin = time.Minute
+
+// cachedToken is token saved in cache directory
+type cachedToken struct {
+	IDToken string    `json:"id_token"`
+	Expiry  time.Time `json:"expiry"`
+	Subject string    `json:"sub"`
+}
+
+// runLogin runs login subcommand and returns exit status
+func runLogin(args []string) int {
+	fs := flag.NewFlagSet("login", flag.ExitOnError)
+	fs.Usage = func() {
+		fmt.Fprint(os.Stderr, loginUsage)
+		fs.PrintDefaults()
+	}
+	path := fs.String("config", configPath(), "path of config file. provider is used")
+	clientID := fs.String("client-id", "", "client_id of CLI. default is provider.client_id")
+	port := fs.Int("port", 0, "port of loopback redirect. default is random")
+	output := fs.String("output", "token", "token, json, kubectl or git")
+	noBrowser := fs.Bool("no-browser", false, "print URL without opening browser")
+	device := fs.Bool("device", false, "use device authorization grant. provider.endpoint.device_auth_url is required")
+	noCache := fs.Bool("no-cache", false, "do not read and write token cache")
+	force := fs.Bool("force", false, "login again even if cached token is valid")
+	fs.Parse(args)
+
+	action := fs.Arg(0)
+	switch action {
+	case "", "get", "store", "erase":
+	default:
+		fs.Usage()
+		return 2
+	}
+	if action == "store" {
+		// token is managed by this command
+		return 0
+	}
+
+	pc, err := loadProvider(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(*clientID) > 0 {
+		pc.ClientID = *clientID
+	}
+	cache := ""
+	if !*noCache {
+		cache = cacheFile(pc)
+	}
+	if action == "erase" {
+		if len(cache) > 0 {
+			os.Remove(cache)
+		}
+		return 0
+	}
+
+	tok := readCache(cache, time.Now())
+	if tok == nil || *force {
+		browse := open.Start
+		if *noBrowser {
+			browse = nil
+		}
+		if *device {
+			// device code expires by expires_in of the provider
+			tok, err = deviceLogin(context.Background(), pc, nil)
+		} else {
+			ctx, cancel := context.WithTimeout(context.Background(), loginTimeout)
+			defer cancel()
+			tok, err = login(ctx, pc, *port, browse, os.Stderr)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Fail login: %s\n", err)
+			return 1
+		}
+		if err := writeCache(cache, tok); err != nil {
+			fmt.Fprintf(os.Stderr, "Fail save token cache: %s\n", err)
+		}
+	}
+	if err := writeCredential(os.Stdout, os.Stdin, *output, tok); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+// loadProvider reads provider of config file with resolved client_secret
+func loadProvider(path string) (*oidc.Config, error) {
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	c, err := parseConfig(b)
+	if err != nil {
+		return nil, err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
+	defer cancel()
+	if errs := c.resolveSecrets(ctx); len(errs) > 0 {
+		return nil, errs
+	}
+	return &c.Provider, nil
+}
+
+// login runs authorization code flow with PKCE and loopback redirect of RFC 8252.
+// open is called with URL of authorization request. URL is only printed when nil.
+func login(ctx context.Context, pc *oidc.Config, port int, open func(string) error, stderr io.Writer) (*cachedToken, error) {
+	kf, err := loadKeyfunc(pc.JWKURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail load JWKS")
+	}
+	l, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer l.Close()
+	redirectURI := fmt.Sprintf("http://%s/callback", l.Addr())
+
+	pkce, err := oidc.NewPKCE()
+	if err != nil {
+		return nil, err
+	}
+	state, nonce := oidc.GenState(), oidc.GenState()
+	scope := strings.Join(pc.Scopes, " ")
+	if len(scope) < 1 {
+		scope = "openid"
+	}
+	q := oidc.URLParams(append(pkce.URLParams(),
+		oidc.SetURLParam("response_type", "code"),
+		oidc.SetURLParam("client_id", pc.ClientID),
+		oidc.SetURLParam("redirect_uri", redirectURI),
+		oidc.SetURLParam("scope", scope),
+		oidc.SetURLParam("state", state),
+		oidc.SetURLParam("nonce", nonce),
+	)...)
+	sep := "?"
+	if strings.Contains(pc.Endpoint.AuthURL, "?") {
+		sep = "&"
+	}
+	u := pc.Endpoint.AuthURL + sep + q.Encode()
+
+	// callback receives only one response
+	type result struct {
+		code string
+		err  error
+	}
+	done := make(chan result, 1)
+	srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/callback" {
+			http.NotFound(w, r)
+			return
+		}
+		q := r.URL.Query()
+		var res result
+		switch {
+		case q.Get("state") != state:
+			res.err = errors.Errorf("Unmatch state")
+		case len(q.Get("error")) > 0:
+			res.err = &oidc.TokenError{Code: q.Get("error"), Description: q.Get("error_description")}
+		case len(q.Get("code")) < 1:
+			res.err = errors.Errorf("Not found code")
+		default:
+			res.code = q.Get("code")
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		if res.err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			fmt.Fprintf(w, "Login failed: %s\n", res.err)
+		} else {
+			fmt.Fprintln(w, "Login succeeded. You can close this window.")
+		}
+		select {
+		case done <- res:
+		default:
+		}
+	})}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	fmt.Fprintf(stderr, "Open the following URL in browser to login:\n\n  %s\n\n", u)
+	if open != nil {
+		if err := open(u); err != nil {
+			fmt.Fprintf(stderr, "Fail open browser: %s\n", err)
+		}
+	}
+
+	var res result
+	select {
+	case res = <-done:
+	case <-ctx.Done():
+		return nil, errors.Errorf("Timeout waiting for callback")
+	}
+	if res.err != nil {
+		return nil, res.err
+	}
+
+	tr, err := oidc.ExchangeCode(ctx, nil, pc, res.code, redirectURI, pkce.Verifier)
+	if err != nil {
+		return nil, err
+	}
+	claims, err := oidc.VerifyIDToken(tr.IDToken, kf, pc)
+	if err != nil {
+		return nil, errors.Wrap(err, "Invalid ID token")
+	}
+	if claims.Nonce != nonce {
+		return nil, errors.Errorf("Unmatch nonce")
+	}
+	tok := &cachedToken{IDToken: tr.IDToken, Subject: claims.Subject, Expiry: claims.Expire()}
+	return tok, nil
+}
+
+// deviceLogin runs device authorization grant of RFC 8628
+func deviceLogin(ctx context.Context, pc *oidc.Config, prompt func(*oidc.DeviceAuthorization)) (*cachedToken, error) {
+	kf, err := loadKeyfunc(pc.JWKURL)
+	if err != nil {
+		return nil, errors.Wrap(err, "Fail load JWKS")
+	}
+	ts, err := oidc.DeviceLogin(ctx, nil, pc, kf, prompt)
+	if err != nil {
+		return nil, err
+	}
+	tok := &cachedToken{IDToken: ts.IDToken, Expiry: ts.Expiry()}
+	tok.Subject, _ = ts.Claims["sub"].(string)
+	return tok, nil
+}
+
+// cacheFile returns path of token cache per provider and client.
+// It is empty when cache directory is not available.
+func cacheFile(pc *oidc.Config) string {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(strings.Join(pc.Issuers, " ") + "\n" + pc.Endpoint.AuthURL + "\n" + pc.ClientID))
+	return filepath.Join(dir, "authproxy", hex.EncodeToString(sum[:8])+".json")
+}
+
+// readCache returns cached token which is valid over loginExpiryMargin
+func readCache(path string, now time.Time) *cachedToken {
+	if len(path) < 1 {
+		return nil
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	var tok cachedToken
+	if err := json.Unmarshal(b, &tok); err != nil || len(tok.IDToken) < 1 {
+		return nil
+	}
+	if tok.Expiry.Sub(now) < loginExpiryMargin {
+		return nil
+	}
+	return &tok
+}
+
+// writeCache saves token readable only by the user
+func writeCache(path string, tok *cachedToken) error {
+	if len(path) < 1 {
+		return nil
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return errors.WithStack(err)
+	}
+	b, err := json.Marshal(tok)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, 0600); err != nil {
+		return errors.WithStack(err)
+	}
+	return errors.WithStack(os.Rename(tmp, path))
+}
+
+// writeCredential prints token in format of output.
+// in is request of git credential helper.
+func writeCredential(w io.Writer, in io.Reader, output string, tok *cachedToken) error {
+	switch output {
+	case "token":
+		fmt.Fprintln(w, tok.IDToken)
+	case "json":
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return errors.WithStack(enc.Encode(tok))
+	case "kubectl":
+		// https://kubernetes.io/docs/reference/access-authn-authz/authentication/#client-go-credential-plugins
+		apiVersion := "client.authentication.k8s.io/v1"
+		var info struct {
+			APIVersion string `json:"apiVersion"`
+		}
+		if err := json.Unmarshal([]byte(os.Getenv("KUBERNETES_EXEC_INFO")), &info); err == nil && len(info.APIVersion) > 0 {
+			apiVersion = info.APIVersion
+		}
+		return errors.WithStack(json.NewEncoder(w).Encode(map[string]interface{}{
+			"apiVersion": apiVersion,
+			"kind":       "ExecCredential",
+			"status": map[string]string{
+				"token":               tok.IDToken,
+				"expirationTimestamp": tok.Expiry.UTC().Format(time.RFC3339),
+			},
+		}))
+	case "git":
+		// git sends attributes and capabilities terminated by blank line
+		authtype := false
+		sc := bufio.NewScanner(in)
+		for sc.Scan() {
+			line := sc.Text()
+			if len(line) < 1 {
+				break
+			}
+			if line == "capability[]=authtype" {
+				authtype = true
+			}
+		}
+		if !authtype {
+			return errors.Errorf("git does not support authtype. git 2.46 or later is required")
+		}
+		fmt.Fprintf(w, "capability[]=authtype\nauthtype=Bearer\ncredential=%s\n", tok.IDToken)
+		if !tok.Expiry.IsZero() {
+			fmt.Fprintf(w, "password_expiry_utc=%d\n", tok.Expiry.Unix())
+		}
+	default:
+		return errors.Errorf("Unknown output [%s]", output)
+	}
+	return nil
+}
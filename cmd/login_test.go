@@ -0,0 +1,192 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quasoft/memstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/errorpage"
+	"github.com/uzuna/go-authproxy/health"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/oidctest"
+	"github.com/uzuna/go-authproxy/routertest"
+)
+
+func TestLogin(t *testing.T) {
+	var pc oidc.Config
+	h, err := routertest.New(routertest.Config{
+		Build: func(e routertest.Env) (http.Handler, error) {
+			pc = e.OIDC
+			conf := &Config{
+				Version:  ConfigVersion,
+				Upstream: UpstreamConfig{URL: e.Upstream.String()},
+				Provider: e.OIDC,
+				Proxy:    ProxyConfig{BearerTokens: true},
+			}
+			conf.setDefaults()
+			ep, err := errorpage.NewErrorPages()
+			if err != nil {
+				return nil, err
+			}
+			return server(conf, memstore.NewMemStore([]byte("authkey123")), ep, health.New(time.Second), &app{})
+		},
+	})
+	checkError(t, err)
+	defer h.Close()
+
+	// browser follows redirect of authorize to the loopback
+	browse := func(u string) error {
+		res, err := http.Get(u)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	tok, err := login(ctx, &pc, 0, browse, ioutil.Discard)
+	checkError(t, err)
+	assert.Equal(t, "oidctest-user", tok.Subject)
+	assert.True(t, tok.Expiry.After(time.Now()))
+
+	// bearer passthrough of the proxy
+	get := func(token string) *http.Response {
+		req, err := http.NewRequest("GET", h.Proxy.URL+"/app", nil)
+		checkError(t, err)
+		req.Header.Set("Authorization", "Bearer "+token)
+		res, err := http.DefaultClient.Do(req)
+		checkError(t, err)
+		return res
+	}
+	res := get(tok.IDToken)
+	var e routertest.Echo
+	checkError(t, json.NewDecoder(res.Body).Decode(&e))
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "Bearer "+tok.IDToken, e.Header.Get("Authorization"))
+	assert.Empty(t, res.Cookies())
+	res = get(tok.IDToken + "x")
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// forged callback
+	forge := func(u string) error {
+		x, _ := url.Parse(u)
+		q := x.Query()
+		_, err := http.Get(q.Get("redirect_uri") + "?state=forged&code=x")
+		return err
+	}
+	_, err = login(ctx, &pc, 0, forge, ioutil.Discard)
+	assert.EqualError(t, err, "Unmatch state")
+
+	// denied by the provider
+	deny := func(u string) error {
+		x, _ := url.Parse(u)
+		q := x.Query()
+		_, err := http.Get(q.Get("redirect_uri") + "?error=access_denied&state=" + q.Get("state"))
+		return err
+	}
+	_, err = login(ctx, &pc, 0, deny, ioutil.Discard)
+	assert.EqualError(t, err, "access_denied")
+}
+
+func TestTokenCache(t *testing.T) {
+	dir, err := ioutil.TempDir("", "authproxy")
+	checkError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "sub", "token.json")
+	now := time.Now()
+
+	assert.Nil(t, readCache(path, now))
+	tok := &cachedToken{IDToken: "x.y.z", Expiry: now.Add(time.Hour).Truncate(time.Second), Subject: "alice"}
+	checkError(t, writeCache(path, tok))
+	fi, err := os.Stat(path)
+	checkError(t, err)
+	assert.Equal(t, os.FileMode(0600), fi.Mode().Perm())
+
+	got := readCache(path, now)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, "x.y.z", got.IDToken)
+	}
+	// expires soon
+	assert.Nil(t, readCache(path, tok.Expiry.Add(-time.Second*30)))
+	assert.Nil(t, readCache("", now))
+}
+
+func TestWriteCredential(t *testing.T) {
+	exp := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	tok := &cachedToken{IDToken: "x.y.z", Expiry: exp, Subject: "alice"}
+	write := func(output, in string) (string, error) {
+		var buf bytes.Buffer
+		err := writeCredential(&buf, strings.NewReader(in), output, tok)
+		return buf.String(), err
+	}
+
+	s, err := write("token", "")
+	checkError(t, err)
+	assert.Equal(t, "x.y.z\n", s)
+
+	s, err = write("json", "")
+	checkError(t, err)
+	assert.Contains(t, s, `"id_token": "x.y.z"`)
+
+	os.Setenv("KUBERNETES_EXEC_INFO", `{"apiVersion":"client.authentication.k8s.io/v1beta1","kind":"ExecCredential"}`)
+	defer os.Unsetenv("KUBERNETES_EXEC_INFO")
+	s, err = write("kubectl", "")
+	checkError(t, err)
+	assert.JSONEq(t, `{
+		"apiVersion": "client.authentication.k8s.io/v1beta1",
+		"kind": "ExecCredential",
+		"status": {"token": "x.y.z", "expirationTimestamp": "2030-01-02T03:04:05Z"}
+	}`, s)
+
+	s, err = write("git", "capability[]=authtype\nprotocol=https\nhost=git.example.com\n\n")
+	checkError(t, err)
+	assert.Equal(t, "capability[]=authtype\nauthtype=Bearer\ncredential=x.y.z\npassword_expiry_utc=1893553445\n", s)
+	_, err = write("git", "protocol=https\nhost=git.example.com\n\n")
+	assert.Error(t, err)
+
+	_, err = write("xml", "")
+	assert.Error(t, err)
+}
+
+func TestDeviceLogin(t *testing.T) {
+	srv, err := oidctest.NewServer(oidctest.Config{DeviceInterval: 1})
+	checkError(t, err)
+	defer srv.Close()
+	pc := srv.OIDCConfig("")
+
+	var buf bytes.Buffer
+	approve := func(da *oidc.DeviceAuthorization) {
+		oidc.PrintDeviceCode(&buf, da)
+		res, err := http.Get(da.VerificationURIComplete)
+		checkError(t, err)
+		res.Body.Close()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	tok, err := deviceLogin(ctx, &pc, approve)
+	checkError(t, err)
+	assert.Equal(t, "oidctest-user", tok.Subject)
+	assert.True(t, tok.Expiry.After(time.Now()))
+	assert.Contains(t, buf.String(), srv.URL+oidctest.DeviceVerifyPath)
+
+	// ID token of unexpected issuer is rejected
+	pc.Issuers = []string{"https://other.example.com"}
+	_, err = deviceLogin(ctx, &pc, func(da *oidc.DeviceAuthorization) {
+		res, err := http.Get(da.VerificationURIComplete)
+		checkError(t, err)
+		res.Body.Close()
+	})
+	assert.Error(t, err)
+}
@@ -1,43 +1,100 @@
 package main
 
 import (
+	"context"
+	"flag"
 	"fmt"
-	"log"
+	"io"
 	"net/http"
 	"net/url"
 	"os"
 	"regexp"
+	"strings"
 	"syscall"
+	"time"
 
 	"github.com/go-chi/chi"
+	"github.com/gorilla/securecookie"
 	"github.com/gorilla/sessions"
 	"github.com/pkg/errors"
 	"github.com/quasoft/memstore"
 	"github.com/sirupsen/logrus"
 	"github.com/uzuna/go-authproxy/errorpage"
+	"github.com/uzuna/go-authproxy/health"
 	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/metrics"
 	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/ratelimit"
 	"github.com/uzuna/go-authproxy/router"
-	"gopkg.in/yaml.v2"
+	"github.com/uzuna/go-authproxy/tracing"
 )
 
 func main() {
+	logrus.SetFormatter(&logrus.JSONFormatter{})
+
+	// subcommands
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "mock-idp":
+			panicError(runMockIDP(os.Args[2:]))
+			return
+		case "config":
+			os.Exit(runConfig(os.Args[2:]))
+		case "token":
+			os.Exit(runToken(os.Args[2:]))
+		case "login":
+			os.Exit(runLogin(os.Args[2:]))
+		}
+	}
+	path := flag.String("config", configPath(), "path of config file")
+	flag.Parse()
 
 	// initialize
-	conf, err := loadConfig()
+	conf, err := loadConfig(*path)
+	panicError(err)
+
+	// start tracing before building router to trace JWKS fetch
+	shutdownTracer, err := tracing.Setup(conf.Proxy.Tracing)
 	panicError(err)
 
+	hc := health.New(time.Second * 3)
+
+	// start admin server before loading JWKS to report readiness
+	var admin *http.Server
+	a := &app{}
+	if conf.Listen.AdminPort > 0 {
+		ar := chi.NewRouter()
+		mountAdmin(ar, hc)
+		ar.Mount("/admin/sessions", &a.sessions)
+		admin = &http.Server{Addr: fmt.Sprintf(":%d", conf.Listen.AdminPort), Handler: ar}
+		go func() {
+			logrus.Infof("Start Admin Listen: %s", admin.Addr)
+			if err := admin.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				logrus.Error(err)
+			}
+		}()
+	}
+
 	// build router
-	r, err := buildRouter(conf)
+	keys, err := newKeyRing(conf)
+	panicError(err)
+	r, err := buildRouter(conf, keys, hc, a)
 	panicError(err)
 
 	// start server
-	addr := fmt.Sprintf(":%d", conf.Port)
+	addr := fmt.Sprintf(":%d", conf.Listen.Port)
 	srv := &http.Server{Addr: addr, Handler: r}
 	go func() {
 		logrus.Infof("Start Listen: %s", addr)
-		if err := srv.ListenAndServe(); err != nil {
-			log.Print(err)
+		var err error
+		if len(conf.Listen.CertFile) > 0 {
+			err = srv.ListenAndServeTLS(conf.Listen.CertFile, conf.Listen.KeyFile)
+		} else {
+			err = srv.ListenAndServe()
+		}
+		if err != nil && err != http.ErrServerClosed {
+			logrus.Error(err)
 		}
 	}()
 
@@ -48,34 +105,67 @@ outloop:
 		sig := <-sigCh
 		switch sig {
 		case syscall.SIGHUP:
-			log.Println("Signal Hungup")
+			logrus.Info("Signal Hungup")
+			if err := reloadSecrets(*path, keys, a.auth); err != nil {
+				logrus.Errorf("Fail reload secrets: %s", err)
+			}
 		default:
 			logrus.Infof("Signal: %s", sig.String())
 			break outloop
 		}
 	}
 	// close server
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if err := srv.Shutdown(ctx); err != nil {
+		logrus.Warnf("Fail shutdown server: %s", err)
+	}
+	if admin != nil {
+		admin.Shutdown(ctx)
+	}
+	if err := a.Close(); err != nil {
+		logrus.Warnf("Fail close audit log: %s", err)
+	}
+	if err := shutdownTracer(ctx); err != nil {
+		logrus.Warnf("Fail shutdown tracer: %s", err)
+	}
 }
 
-// locaf config and initialize structs
-func buildRouter(conf *Config) (http.Handler, error) {
-	// load config
-	f, err := os.Open(conf.AuthConfigFile)
-	if err != nil {
-		return nil, errors.WithStack(err)
-	}
-	dec := yaml.NewDecoder(f)
-	var oidcconf oidc.Config
-	err = dec.Decode(&oidcconf)
-	if err != nil {
-		return nil, errors.WithStack(err)
+// app holds parts of the built router which main serves, reloads and closes
+type app struct {
+	// sessions is admin API of sessions. It responds 503 until the router is built
+	sessions lazyHandler
+	// auth receives client_secret resolved again on reload
+	auth oidc.ClientSecretSetter
+	// closers are closed after the server is shut down
+	closers []io.Closer
+}
+
+// Close flushes and closes outputs of the router
+func (a *app) Close() error {
+	var err error
+	for _, c := range a.closers {
+		if cerr := c.Close(); cerr != nil && err == nil {
+			err = errors.WithStack(cerr)
+		}
 	}
+	return err
+}
+
+// initialize structs from config
+func buildRouter(conf *Config, keys *session.KeyRing, hc *health.Health, a *app) (http.Handler, error) {
+	pconf := conf.Proxy
 
 	// Init session
-	store := memstore.NewMemStore(
-		[]byte("authkey123"),
-		[]byte("enckey12341234567890123456789012"),
-	)
+	store := memstore.NewMemStore()
+	store.Codecs = []securecookie.Codec{keys}
+	if err := pconf.Cookie.Apply(store.Options); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if pconf.Cookie.MaxAge != 0 {
+		store.MaxAge(pconf.Cookie.MaxAge)
+	}
+	keys.MaxAge(store.Options.MaxAge)
 
 	// Init CustomErrorPages
 	ep, err := errorpage.NewErrorPages()
@@ -83,39 +173,95 @@ func buildRouter(conf *Config) (http.Handler, error) {
 		return nil, errors.WithStack(err)
 	}
 
-	return server(conf, oidcconf, store, ep)
+	return server(conf, store, ep, hc, a)
 }
 
 // build http router
 func server(conf *Config,
-	oidcconf oidc.Config,
 	store sessions.Store,
-	ep *errorpage.ErrorPages) (http.Handler, error) {
+	ep *errorpage.ErrorPages,
+	hc *health.Health,
+	a *app) (http.Handler, error) {
 
-	// session名
-	sessionName := conf.SessionName
+	oidcconf := conf.Provider
+	sessionName := conf.Proxy.Cookie.Name
 	aikey := &contextKey{"authinfo"}
 
 	// OIDC RouterProvider
-	auth, err := oidc.NewAuthenticator(&oidcconf)
+	auth, err := newAuthenticator(context.Background(), &oidcconf, hc)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	if v, ok := auth.(oidc.ClientSecretSetter); ok {
+		a.auth = v
+	}
 	aStore := session.NewAuthStore(store, sessionName, aikey)
+	metrics.SetActiveSessions(aStore.Active)
+	hc.Add("session", aStore.Ping)
+
+	list := conf.Proxy.Headers
+	if len(list) < 1 {
+		list = []router.AdditionalHeader{
+			{ClaimKey: "preferred_username", HeaderName: "X-Username"},
+		}
+	}
+	idHeaders := conf.Proxy.IdentityHeaders
+	for _, v := range list {
+		idHeaders = append(idHeaders, v.HeaderName)
+	}
+	trusted, err := router.ParseCIDRs(conf.Proxy.TrustedProxies)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	opts := []router.Option{
+		router.IdentityHeaders(idHeaders...),
+		router.TrustedProxies(trusted...),
+	}
+	// relative redirect_url is resolved by client origin
+	if strings.HasPrefix(oidcconf.RedirectURL, "/") {
+		opts = append(opts, router.CallbackPath(oidcconf.RedirectURL))
+	}
+	if uc := oidc.NewUserInfoClient(oidcconf.UserInfoURL); uc != nil {
+		opts = append(opts, router.UserInfo(uc, conf.Proxy.UserInfoRefresh))
+	}
+	// form_post callback comes from the provider
+	au, err := url.Parse(oidcconf.Endpoint.AuthURL)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	rp := router.New(auth, aStore, ep, aikey)
+	cbOrigins := append([]string{au.Scheme + "://" + au.Host}, conf.Proxy.CallbackOrigins...)
+	opts = append(opts, router.CallbackOrigins(cbOrigins...))
+	opts = append(opts, router.Policy(conf.Proxy.Session))
+	opts = append(opts, router.Leeway(oidcconf.ClockLeeway()))
+	auditor := logging.NewAuditor(conf.Proxy.Audit)
+	a.closers = append(a.closers, auditor)
+	opts = append(opts, router.Audit(auditor))
+	if v, ok := auth.(oidc.TokenVerifier); ok && conf.Proxy.BearerTokens {
+		opts = append(opts, router.BearerTokens(v))
+	}
+	rp := router.New(auth, aStore, ep, aikey, opts...)
+
+	// session admin API on admin listener
+	if v, ok := auth.(oidc.TokenVerifier); ok && len(conf.Proxy.Admin.Claim) > 0 {
+		a.sessions.Set(rp.SessionAdmin(v, conf.Proxy.Admin))
+	} else {
+		a.sessions.Set(http.NotFoundHandler())
+	}
 
 	// ReverseProxy
-	u, err := url.Parse(conf.ForwardTo)
+	u, err := url.Parse(conf.Upstream.URL)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	rph, err := rp.ReverseProxy(u, list)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
-	list := []router.AdditionalHeader{
-		{"preferred_username", "X-Username"},
+	hc.Add("upstream", upstreamCheck(u, conf.Upstream.HealthPath))
+	csrf, err := rp.CSRF(conf.Proxy.CSRF)
+	if err != nil {
+		return nil, errors.WithStack(err)
 	}
-	rph := rp.ReverseProxy(u, list)
 
 	// mux
 	r := chi.NewRouter()
@@ -126,9 +272,29 @@ func server(conf *Config,
 		ep.Error(w, r, s, 404)
 	})
 
+	// trace all requests
+	r.Use(logging.RequestID)
+	r.Use(tracing.Middleware("authproxy"))
+
+	// resolve client over trusted proxies
+	r.Use(rp.ResolveClient())
+
+	// write access log
+	r.Use(logging.AccessLog(logrus.StandardLogger(), func(r *http.Request) string {
+		return rp.Client(r).IP
+	}))
+
+	// remove client-supplied identity headers
+	r.Use(rp.StripHeaders())
+
 	// mount session information
 	r.Use(rp.LoadSession())
 
+	// limit requests before authentication and proxy
+	if len(conf.Proxy.RateLimits) > 0 {
+		r.Use(rp.RateLimit(ratelimit.NewMemoryStore(), conf.Proxy.RateLimits))
+	}
+
 	// Route of Authenticate CallBack
 	// Parse Authenticate response
 	// and authinfo to set to session store
@@ -136,18 +302,41 @@ func server(conf *Config,
 
 	// Route of Login Redirect
 	// This generates and to redierct to AuthURL for OIDC login
-	reRef := regexp.MustCompile(conf.AcceptOriginPtn)
+	reRef := regexp.MustCompile(conf.Proxy.AcceptOrigin)
 	erp := router.ReferrerMatch(reRef)
 	r.Method("GET", "/login", rp.Login(erp))
+	r.With(csrf).Method("POST", "/logout", rp.Logout())
+
+	// Session introspection for front-end apps
+	me := rp.Me(conf.Proxy.Me)
+	r.Method("GET", "/.auth/me", me)
+	r.Method("OPTIONS", "/.auth/me", me)
+
+	// health, build-info and metrics on public port only by opt-in
+	if conf.Listen.AdminPort < 1 && conf.Listen.PublicAdmin {
+		mountAdmin(r, hc)
+	}
 
 	// Accept Public files
 	r.Route("/public", func(r chi.Router) {
 		r.Handle("/*", rph)
 	})
 
+	// sensitive routes must login recently
+	for _, v := range conf.Proxy.SensitiveRoutes {
+		maxAge := v.MaxAge
+		r.Route(v.Path, func(r chi.Router) {
+			r.Use(rp.AuthRedirect())
+			r.Use(csrf)
+			r.Use(rp.RequireRecentAuth(maxAge))
+			r.Handle("/*", rph)
+		})
+	}
+
 	// other route must login
 	r.Route("/", func(r chi.Router) {
 		r.Use(rp.AuthRedirect())
+		r.Use(csrf)
 		r.Handle("/*", rph)
 	})
 	return r, nil
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/quasoft/memstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/errorpage"
+	"github.com/uzuna/go-authproxy/health"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/oidctest"
+	"github.com/uzuna/go-authproxy/router"
+	"github.com/uzuna/go-authproxy/routertest"
+)
+
+// newServer runs server of the config between mock IdP and echo upstream
+func newServer(t *testing.T, a *app, modify func(c *Config)) *routertest.Harness {
+	if a == nil {
+		a = &app{}
+	}
+	h, err := routertest.New(routertest.Config{
+		Provider: oidctest.Config{
+			Claims: map[string]interface{}{
+				"sub":                "alice",
+				"preferred_username": "alice@example.com",
+			},
+		},
+		Build: func(e routertest.Env) (http.Handler, error) {
+			conf := &Config{
+				Version:  ConfigVersion,
+				Upstream: UpstreamConfig{URL: e.Upstream.String()},
+				Provider: e.OIDC,
+				Proxy: ProxyConfig{
+					AcceptOrigin: `^http://127\.0\.0\.1`,
+					Cookie:       session.CookieConfig{Name: "authproxy"},
+					CSRF:         router.CSRFConfig{Mode: "origin"},
+					SensitiveRoutes: []SensitiveRoute{
+						{Path: "/sensitive", MaxAge: time.Minute},
+					},
+				},
+			}
+			if modify != nil {
+				modify(conf)
+			}
+			store := memstore.NewMemStore([]byte("authkey123"))
+			ep, err := errorpage.NewErrorPages()
+			if err != nil {
+				return nil, err
+			}
+			conf.setDefaults()
+			if err := conf.Validate(); err != nil {
+				return nil, err
+			}
+			return server(conf, store, ep, health.New(time.Second), a)
+		},
+	})
+	checkError(t, err)
+	return h
+}
+
+func TestServer(t *testing.T) {
+	h := newServer(t, nil, nil)
+	defer h.Close()
+
+	// health is not served on public port without public_admin
+	res, err := h.Get("/healthz")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res, err = h.Login()
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+
+	e, err := h.GetEcho("/app", nil)
+	checkError(t, err)
+	assert.Equal(t, "alice@example.com", e.Header.Get("X-Username"))
+	_, err = h.GetEcho("/sensitive/page", nil)
+	checkError(t, err)
+
+	res, err = h.Get("/public/file")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+
+	res, err = h.Logout()
+	checkError(t, err)
+	res.Body.Close()
+	res, err = h.Get("/app")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestCallbackOrigin(t *testing.T) {
+	// origin of the provider is checked without csrf
+	h := newServer(t, nil, func(c *Config) { c.Proxy.CSRF = router.CSRFConfig{} })
+	defer h.Close()
+
+	form, action, err := h.Authorize()
+	checkError(t, err)
+	req, err := http.NewRequest("POST", action, strings.NewReader(form.Encode()))
+	checkError(t, err)
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", "https://evil.example.com")
+	res, err := h.Client.Do(req)
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res, err = h.Login()
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+}
+
+type closeCounter struct {
+	n int
+}
+
+func (c *closeCounter) Close() error {
+	c.n++
+	return nil
+}
+
+func TestAppClose(t *testing.T) {
+	c := &closeCounter{}
+	a := &app{closers: []io.Closer{c, c}}
+	checkError(t, a.Close())
+	assert.Equal(t, 2, c.n)
+
+	// auditor of the config is closed on shutdown
+	dir, err := ioutil.TempDir("", "authproxy")
+	checkError(t, err)
+	defer os.RemoveAll(dir)
+	a = &app{}
+	h := newServer(t, a, func(c *Config) { c.Proxy.Audit.Output = filepath.Join(dir, "audit.log") })
+	defer h.Close()
+	if assert.Len(t, a.closers, 1) {
+		_, ok := a.closers[0].(*logging.Auditor)
+		assert.True(t, ok)
+	}
+	checkError(t, a.Close())
+}
+
+func checkError(t *testing.T, err error) {
+	if err != nil {
+		t.Logf("%+v", err)
+		t.FailNow()
+	}
+}
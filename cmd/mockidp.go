@@ -0,0 +1,82 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/oidctest"
+	"gopkg.in/yaml.v2"
+)
+
+// runMockIDP serves mock OpenID Provider for development without network access
+func runMockIDP(args []string) error {
+	fs := flag.NewFlagSet("mock-idp", flag.ExitOnError)
+	addr := fs.String("addr", "127.0.0.1:9999", "listen address")
+	issuer := fs.String("issuer", "", "issuer URL. default is http://{addr}")
+	clientID := fs.String("client-id", "", "accepted client id. any client is accepted when empty")
+	clientSecret := fs.String("client-secret", "", "client secret required on token endpoint")
+	sub := fs.String("sub", "mock-user", "sub of auto login user")
+	claims := fs.String("claims", "", `JSON of claims of the user. e.g. '{"email":"jane@example.com"}'`)
+	lifetime := fs.Duration("token-lifetime", time.Hour, "lifetime of tokens")
+	fs.Parse(args)
+
+	c := oidctest.Config{
+		Issuer:        *issuer,
+		ClientID:      *clientID,
+		ClientSecret:  *clientSecret,
+		Claims:        map[string]interface{}{},
+		TokenLifetime: *lifetime,
+	}
+	if len(c.Issuer) < 1 {
+		c.Issuer = "http://" + *addr
+	}
+	if len(*claims) > 0 {
+		if err := json.Unmarshal([]byte(*claims), &c.Claims); err != nil {
+			return errors.Wrap(err, "invalid -claims")
+		}
+	}
+	if _, ok := c.Claims["sub"]; !ok {
+		c.Claims["sub"] = *sub
+	}
+	p, err := oidctest.New(c)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+
+	// config of the proxy to use the provider
+	// client_secret is redacted on print
+	pc := p.OIDCConfig("/cb")
+	pc.ClientSecret = ""
+	b, err := yaml.Marshal(yaml.MapSlice{
+		{Key: "version", Value: ConfigVersion},
+		{Key: "provider", Value: pc},
+	})
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	fmt.Fprintf(os.Stderr, "# config.yml\n%s", b)
+	if len(c.ClientSecret) > 0 {
+		fmt.Fprintf(os.Stderr, "# set provider.client_secret to the value of -client-secret\n")
+	}
+	fmt.Fprintln(os.Stderr)
+
+	srv := &http.Server{Addr: *addr, Handler: p}
+	go func() {
+		logrus.Infof("Start mock IdP: %s", c.Issuer)
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			logrus.Error(err)
+		}
+	}()
+	sig := <-WaitSignal()
+	logrus.Infof("Signal: %s", sig.String())
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	return errors.WithStack(srv.Shutdown(ctx))
+}
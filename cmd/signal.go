@@ -7,7 +7,7 @@ import (
 )
 
 func WaitSignal() <-chan os.Signal {
-	quit := make(chan os.Signal)
+	quit := make(chan os.Signal, 1)
 
 	signal.Notify(quit,
 		syscall.SIGHUP,  // Hungup プロセスに設定ファイルの読み込みを要求
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/lestrrat-go/jwx/jwk"
+	"github.com/pkg/errors"
+	"github.com/uzuna/go-authproxy/oidc"
+)
+
+const tokenUsage = `Usage: authproxy token inspect [flags] [token]
+
+Subcommands:
+  inspect  decode ID token and verify it against the provider of config.
+           token is read from stdin when omitted or "-".
+           exit status is 1 when any check fails
+`
+
+// runToken runs token subcommands and returns exit status
+func runToken(args []string) int {
+	if len(args) < 1 || args[0] != "inspect" {
+		fmt.Fprint(os.Stderr, tokenUsage)
+		return 2
+	}
+	fs := flag.NewFlagSet("token inspect", flag.ExitOnError)
+	path := fs.String("config", configPath(), "path of config file. provider is used")
+	jwks := fs.String("jwks", "", "URL or file of JWKS. default is provider.jwk_url")
+	clientID := fs.String("client-id", "", "expected audience. default is provider.client_id")
+	issuer := fs.String("issuer", "", "expected issuer. default is provider.issuers")
+	skew := fs.Duration("skew", 0, "allowed clock difference. default is provider.leeway")
+	asJSON := fs.Bool("json", false, "print as JSON")
+	fs.Parse(args[1:])
+
+	token := fs.Arg(0)
+	if len(token) < 1 || token == "-" {
+		b, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		token = string(b)
+	}
+
+	var pc oidc.Config
+	if b, err := ioutil.ReadFile(*path); err == nil {
+		c, err := parseConfig(b)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			return 2
+		}
+		pc = c.Provider
+	} else if len(*jwks) < 1 {
+		fmt.Fprintln(os.Stderr, err)
+		return 2
+	}
+	if len(*jwks) > 0 {
+		pc.JWKURL = *jwks
+	}
+	if len(*clientID) > 0 {
+		pc.ClientID = *clientID
+	}
+	if len(*issuer) > 0 {
+		pc.Issuers = []string{*issuer}
+	}
+
+	kf, err := loadKeyfunc(pc.JWKURL)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Fail load JWKS: %s\n", err)
+	}
+	var o oidc.InspectOptions
+	if flagSet(fs, "skew") {
+		o.Skew = skew
+	}
+	in := oidc.InspectIDToken(token, kf, &pc, o)
+	if *asJSON {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(in)
+	} else {
+		printInspection(os.Stdout, in, time.Now())
+	}
+	if !in.Valid() {
+		return 1
+	}
+	return 0
+}
+
+// flagSet reports the flag is given in command line
+func flagSet(fs *flag.FlagSet, name string) bool {
+	found := false
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			found = true
+		}
+	})
+	return found
+}
+
+// loadKeyfunc loads JWKS from URL or file
+func loadKeyfunc(src string) (jwt.Keyfunc, error) {
+	if len(src) < 1 {
+		return nil, errors.Errorf("jwk_url is empty")
+	}
+	if strings.HasPrefix(src, "http://") || strings.HasPrefix(src, "https://") {
+		set, err := jwk.FetchHTTP(src)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		return oidc.MakeKeyfunc(set)
+	}
+	b, err := ioutil.ReadFile(src)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return oidc.ParseJWK(b)
+}
+
+// timeClaims are NumericDate claims annotated in text output
+var timeClaims = []string{"iat", "nbf", "auth_time", "exp"}
+
+// printInspection prints header, claims and checks in readable form
+func printInspection(w io.Writer, in *oidc.Inspection, now time.Time) {
+	if in.Header != nil {
+		b, _ := json.MarshalIndent(in.Header, "", "  ")
+		fmt.Fprintf(w, "Header:\n%s\n", b)
+	}
+	if in.Claims != nil {
+		b, _ := json.MarshalIndent(in.Claims, "", "  ")
+		fmt.Fprintf(w, "Claims:\n%s\n", b)
+		for _, k := range timeClaims {
+			n, ok := in.Claims[k].(json.Number)
+			if !ok {
+				continue
+			}
+			sec, err := n.Int64()
+			if err != nil {
+				continue
+			}
+			t := time.Unix(sec, 0)
+			fmt.Fprintf(w, "  %-9s %s (%s)\n", k, t.UTC().Format(time.RFC3339), relative(t, now))
+		}
+	}
+	fmt.Fprintln(w, "Checks:")
+	for _, v := range in.Checks {
+		line := fmt.Sprintf("  %-6s %-9s %s", "["+strings.ToUpper(v.Status)+"]", v.Name, v.Message)
+		fmt.Fprintln(w, strings.TrimRight(line, " "))
+	}
+}
+
+// relative formats t from now
+func relative(t, now time.Time) string {
+	d := t.Sub(now).Round(time.Second)
+	if d < 0 {
+		return (-d).String() + " ago"
+	}
+	return "in " + d.String()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/oidctest"
+)
+
+func TestInspectToken(t *testing.T) {
+	srv, err := oidctest.NewServer(oidctest.Config{})
+	checkError(t, err)
+	defer srv.Close()
+	pc := srv.OIDCConfig("/cb")
+	token, err := srv.IDToken(pc.ClientID, "n-0S6_WzA2Mj", nil)
+	checkError(t, err)
+	kf, err := loadKeyfunc(pc.JWKURL)
+	checkError(t, err)
+
+	var buf bytes.Buffer
+	in := oidc.InspectIDToken(token, kf, &pc, oidc.InspectOptions{})
+	assert.True(t, in.Valid(), "%+v", in.Checks)
+	printInspection(&buf, in, time.Now())
+	assert.Contains(t, buf.String(), `"sub": "oidctest-user"`)
+	assert.Contains(t, buf.String(), "[OK]   signature RS256")
+	assert.Regexp(t, `exp +\d{4}-\d\d-\d\dT\S+ \(in `, buf.String())
+
+	pc.ClientID = "other"
+	pc.Issuers = []string{"https://issuer.example.com"}
+	in = oidc.InspectIDToken(token, kf, &pc, oidc.InspectOptions{})
+	assert.False(t, in.Valid())
+	buf.Reset()
+	printInspection(&buf, in, time.Now())
+	assert.Contains(t, buf.String(), "[FAIL] audience  Unacceptable Audience")
+	assert.Contains(t, buf.String(), "[FAIL] issuer    Unacceptable Issuer")
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/uzuna/go-authproxy/router"
+)
+
+// FieldError is invalid value at path of config
+type FieldError struct {
+	// Path is location in config file. e.g. "rate_limits[0].key"
+	Path    string
+	Message string
+}
+
+func (e *FieldError) Error() string {
+	return e.Path + ": " + e.Message
+}
+
+// ValidationError is list of invalid values
+type ValidationError []*FieldError
+
+func (e ValidationError) Error() string {
+	list := make([]string, len(e))
+	for i, v := range e {
+		list[i] = v.Error()
+	}
+	return "invalid config\n" + strings.Join(list, "\n")
+}
+
+// validator collects FieldError
+type validator struct {
+	errs ValidationError
+}
+
+func (v *validator) errorf(path string, format string, args ...interface{}) {
+	v.errs = append(v.errs, &FieldError{Path: path, Message: fmt.Sprintf(format, args...)})
+}
+
+// url checks absolute URL of http or https
+func (v *validator) url(path, s string, required bool) {
+	if len(s) < 1 {
+		if required {
+			v.errorf(path, "is required")
+		}
+		return
+	}
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || len(u.Host) < 1 {
+		v.errorf(path, "must be absolute http(s) URL [%s]", s)
+	}
+}
+
+// path checks path begins with "/"
+func (v *validator) path(path, s string) {
+	if !strings.HasPrefix(s, "/") {
+		v.errorf(path, "must begin with \"/\" [%s]", s)
+	}
+}
+
+// Validate reports all invalid values with the path
+func (c *Config) Validate() error {
+	v := &validator{}
+	if c.Version != ConfigVersion {
+		v.errorf("version", "unsupported version %d. supported version is %d", c.Version, ConfigVersion)
+	}
+
+	// listeners
+	if c.Listen.Port < 1 || c.Listen.Port > 65535 {
+		v.errorf("listen.port", "must be in 1-65535 [%d]", c.Listen.Port)
+	}
+	if c.Listen.AdminPort < 0 || c.Listen.AdminPort > 65535 {
+		v.errorf("listen.admin_port", "must be in 0-65535 [%d]", c.Listen.AdminPort)
+	} else if c.Listen.AdminPort == c.Listen.Port {
+		v.errorf("listen.admin_port", "must be different from port")
+	} else if c.Listen.AdminPort > 0 && c.Listen.PublicAdmin {
+		v.errorf("listen.public_admin", "must not be set with admin_port")
+	}
+	if (len(c.Listen.CertFile) > 0) != (len(c.Listen.KeyFile) > 0) {
+		v.errorf("listen", "cert_file and key_file must be set together")
+	}
+
+	// upstream
+	v.url("upstream.url", c.Upstream.URL, true)
+	if len(c.Upstream.HealthPath) > 0 {
+		v.path("upstream.health_path", c.Upstream.HealthPath)
+	}
+
+	// provider
+	p := c.Provider
+	if len(p.ClientID) < 1 {
+		v.errorf("provider.client_id", "is required")
+	}
+	v.url("provider.endpoint.auth_url", p.Endpoint.AuthURL, true)
+	v.url("provider.endpoint.token_url", p.Endpoint.TokenURL, false)
+	v.url("provider.endpoint.device_auth_url", p.Endpoint.DeviceAuthURL, false)
+	v.url("provider.jwk_url", p.JWKURL, true)
+	v.url("provider.userinfo_url", p.UserInfoURL, false)
+	if strings.HasPrefix(p.RedirectURL, "/") {
+		v.path("provider.redirect_url", p.RedirectURL)
+	} else {
+		v.url("provider.redirect_url", p.RedirectURL, true)
+	}
+	if !strings.Contains(p.ResponseType, "id_token") {
+		v.errorf("provider.response_type", "must contain id_token [%s]", p.ResponseType)
+	}
+	if !contains(p.Scopes, "openid") {
+		v.errorf("provider.scopes", "must contain openid")
+	}
+	for i, s := range p.Issuers {
+		v.url(fmt.Sprintf("provider.issuers[%d]", i), s, true)
+	}
+	if p.Leeway != nil && *p.Leeway < 0 {
+		v.errorf("provider.leeway", "must not be negative")
+	}
+	for i, s := range p.ClientIDs {
+		if len(s) < 1 {
+			v.errorf(fmt.Sprintf("provider.client_ids[%d]", i), "is empty")
+		}
+	}
+	if len(p.Checks.TenantClaim) > 0 && len(p.Checks.Tenants) < 1 {
+		v.errorf("provider.checks.tenants", "is required with tenant_claim")
+	}
+
+	for i, k := range c.SessionKeys {
+		p := fmt.Sprintf("session_keys[%d]", i)
+		if len(k.Auth) < 1 {
+			v.errorf(p+".auth", "is required")
+		}
+		switch len(k.Encryption) {
+		case 0, 16, 24, 32:
+		default:
+			v.errorf(p+".encryption", "must be 16, 24 or 32 bytes but %d bytes", len(k.Encryption))
+		}
+	}
+
+	// routes and policies
+	x := c.Proxy
+	if _, err := regexp.Compile(x.AcceptOrigin); err != nil {
+		v.errorf("accept_origin", "invalid pattern: %s", err)
+	}
+	if _, err := router.NewHeaderMapper(x.Headers); err != nil {
+		// message begins with the path. e.g. "headers[0]: header name is empty"
+		p, msg := "headers", err.Error()
+		if i := strings.Index(msg, ": "); i > 0 && strings.HasPrefix(msg, p) {
+			p, msg = msg[:i], msg[i+2:]
+		}
+		v.errorf(p, "%s", msg)
+	}
+	for i, s := range x.TrustedProxies {
+		if _, err := router.ParseCIDRs([]string{s}); err != nil {
+			v.errorf(fmt.Sprintf("trusted_proxies[%d]", i), "invalid CIDR or ip address [%s]", s)
+		}
+	}
+	if x.UserInfoRefresh < 0 {
+		v.errorf("userinfo_refresh", "must not be negative")
+	}
+	if _, err := x.Cookie.SameSiteMode(); err != nil {
+		v.errorf("cookie.same_site", "%s", err)
+	}
+	switch x.CSRF.Mode {
+	case router.CSRFModeNone, router.CSRFModeOrigin, router.CSRFModeDoubleSubmit:
+	default:
+		v.errorf("csrf.mode", "must be %q or %q [%s]", router.CSRFModeOrigin, router.CSRFModeDoubleSubmit, x.CSRF.Mode)
+	}
+	for i, s := range x.CSRF.TrustedOrigins {
+		v.url(fmt.Sprintf("csrf.trusted_origins[%d]", i), s, true)
+	}
+	for i, s := range x.CallbackOrigins {
+		v.url(fmt.Sprintf("callback_origins[%d]", i), s, true)
+	}
+
+	s := x.Session
+	if s.IdleTimeout < 0 {
+		v.errorf("session.idle_timeout", "must not be negative")
+	}
+	if s.AbsoluteTimeout < 0 {
+		v.errorf("session.absolute_timeout", "must not be negative")
+	}
+	if s.MaxSessions < 0 {
+		v.errorf("session.max_sessions", "must not be negative")
+	}
+	switch s.OnLimit {
+	case "", router.OnLimitEvict, router.OnLimitRefuse:
+	default:
+		v.errorf("session.on_limit", "must be %q or %q [%s]", router.OnLimitEvict, router.OnLimitRefuse, s.OnLimit)
+	}
+	for i, r := range x.SensitiveRoutes {
+		p := fmt.Sprintf("sensitive_routes[%d]", i)
+		v.path(p+".path", r.Path)
+		if r.MaxAge <= 0 {
+			v.errorf(p+".max_age", "must be positive")
+		}
+	}
+	if len(x.Admin.Claim) > 0 && len(x.Admin.Values) < 1 {
+		v.errorf("admin.values", "is required with claim")
+	}
+	for i, r := range x.RateLimits {
+		p := fmt.Sprintf("rate_limits[%d]", i)
+		v.path(p+".path", r.Path)
+		switch r.Key {
+		case router.RateLimitByIP, router.RateLimitBySub:
+		default:
+			v.errorf(p+".key", "must be %q or %q [%s]", router.RateLimitByIP, router.RateLimitBySub, r.Key)
+		}
+		if r.Requests < 1 {
+			v.errorf(p+".requests", "must be positive")
+		}
+		if r.Per <= 0 {
+			v.errorf(p+".per", "must be positive")
+		}
+		if r.Burst < 0 {
+			v.errorf(p+".burst", "must not be negative")
+		}
+	}
+
+	if len(v.errs) > 0 {
+		return v.errs
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -7,6 +7,7 @@ import (
 	"net/http"
 
 	"github.com/uzuna/go-authproxy/bindata"
+	"github.com/uzuna/go-authproxy/tracing"
 )
 
 // ErrorHandlerFunc is implementation of ErrorPage Renderer
@@ -16,6 +17,7 @@ type ErrorHandlerFunc func(w http.ResponseWriter, r *http.Request, e *ErrorRecor
 type ErrorRecord struct {
 	StatusCode int
 	Message    string
+	TraceID    string // trace id of the request for diagnosis
 }
 
 // NewErrorPages create instance of ErrorPages
@@ -63,11 +65,12 @@ func (e *ErrorPages) ErrorHandlerFunc(code int, f ErrorHandlerFunc) {
 }
 
 func (e *ErrorPages) Error(w http.ResponseWriter, r *http.Request, err string, code int) {
+	er := &ErrorRecord{StatusCode: code, Message: err, TraceID: tracing.TraceID(r.Context())}
 	if _, ok := e.Map[code]; !ok {
-		e.defaultHandlerFunc(w, r, &ErrorRecord{StatusCode: code, Message: err})
+		e.defaultHandlerFunc(w, r, er)
 		return
 	}
-	e.Map[code](w, r, &ErrorRecord{StatusCode: code, Message: err})
+	e.Map[code](w, r, er)
 }
 
 func (e *ErrorPages) DefaultHandlerFunc(f ErrorHandlerFunc) {
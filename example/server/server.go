@@ -53,7 +53,9 @@ func main() {
 	// CustomErrorPages
 	ep, err := errorpage.NewErrorPages()
 	panicError(err)
-	rp := router.New(a, as, ep, aikey)
+	rp := router.New(a, as, ep, aikey,
+		router.IdentityHeaders("X-Username", "X-Groups", "X-Display-Name"),
+	)
 	server(rp, ep, aikey)
 }
 
@@ -70,9 +72,14 @@ func server(rp router.RouteProvider, ep *errorpage.ErrorPages, aikey interface{}
 		return errors.WithStack(err)
 	}
 	list := []router.AdditionalHeader{
-		{"preferred_username", "X-Username"},
+		{ClaimKey: "preferred_username", HeaderName: "X-Username"},
+		{ClaimKey: "groups", HeaderName: "X-Groups", Separator: ","},
+		{Template: "{{.given_name}} {{.family_name}}", HeaderName: "X-Display-Name"},
+	}
+	rvh, err := rp.ReverseProxy(u, list)
+	if err != nil {
+		return errors.WithStack(err)
 	}
-	rvh := rp.ReverseProxy(u, list)
 
 	// mux
 	r := chi.NewRouter()
@@ -83,6 +90,12 @@ func server(rp router.RouteProvider, ep *errorpage.ErrorPages, aikey interface{}
 		ep.Error(w, r, s, 404)
 	})
 
+	// resolve client over trusted proxies
+	r.Use(rp.ResolveClient())
+
+	// remove client-supplied identity headers
+	r.Use(rp.StripHeaders())
+
 	// mount session information
 	r.Use(rp.LoadSession())
 
@@ -96,6 +109,8 @@ func server(rp router.RouteProvider, ep *errorpage.ErrorPages, aikey interface{}
 	reRef := regexp.MustCompile(`^https?\:\/{2}localhost:8989\/.+$`)
 	erp := router.ReferrerMatch(reRef)
 	r.Method("GET", "/login", rp.Login(erp))
+	r.Method("POST", "/logout", rp.Logout())
+	r.Method("GET", "/.auth/me", rp.Me(router.MeConfig{}))
 
 	// Route of Top page
 	r.MethodFunc("GET", "/", func(w http.ResponseWriter, r *http.Request) {
@@ -109,7 +124,7 @@ func server(rp router.RouteProvider, ep *errorpage.ErrorPages, aikey interface{}
 		// show
 		w.Header().Set("Content-Type", "text/html")
 		diff := ainfo.ExpireAt.Sub(time.Now())
-		fmt.Fprintf(w, "<a href=\"/login\">Login</a>")
+		fmt.Fprintf(w, "<a href=\"/login\">Login</a> <form method=\"post\" action=\"/logout\"><button>Logout</button></form> <a href=\"/.auth/me\">Me</a>")
 		fmt.Fprintf(w, "<p>Accept. LoggedIn: %v, Expires: %s ,ExpireAt: %s</p>", ainfo.LoggedIn, diff.String(), ainfo.ExpireAt.String())
 	})
 
@@ -134,7 +149,7 @@ func server(rp router.RouteProvider, ep *errorpage.ErrorPages, aikey interface{}
 	recho.MethodFunc("GET", "/*", func(w http.ResponseWriter, r *http.Request) {
 		// Check Header
 		// bearer := r.Header.Get("Authorization")
-		forw := r.Header.Get("Forwerded")
+		forw := r.Header.Get("Forwarded")
 		uname := r.Header.Get("X-Username")
 		// show
 		// w.Header().Set("Content-Type", "text/html")
@@ -143,6 +158,9 @@ func server(rp router.RouteProvider, ep *errorpage.ErrorPages, aikey interface{}
 		// fmt.Fprintf(w, "<p>Wellcome to [%s]. LoggedIn: %v, Expires: %s ,ExpireAt: %s</p>", r.URL.Path, ainfo.LoggedIn, diff.String(), ainfo.ExpireAt.String())
 		// w.Write([]byte(bearer+\r\n))
 		w.Write([]byte(forw + "\r\n"))
+		w.Write([]byte(r.Header.Get("X-Forwarded-For") + "\r\n"))
+		w.Write([]byte(r.Header.Get("X-Forwarded-Proto") + "\r\n"))
+		w.Write([]byte(r.Header.Get("X-Forwarded-Host") + "\r\n"))
 		w.Write([]byte(uname))
 	})
 	s2addr := ":8080"
@@ -154,7 +172,7 @@ func server(rp router.RouteProvider, ep *errorpage.ErrorPages, aikey interface{}
 		}
 	}()
 
-	ch := make(chan os.Signal)
+	ch := make(chan os.Signal, 1)
 	signal.Notify(ch, os.Interrupt)
 	<-ch
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
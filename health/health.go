@@ -0,0 +1,202 @@
+// Package health serves liveness, readiness and build information for orchestrators.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Check returns error when the dependency is not ready
+type Check func(ctx context.Context) error
+
+// New creates Health with timeout of each readiness check
+func New(timeout time.Duration) *Health {
+	return &Health{
+		lock:    new(sync.RWMutex),
+		checks:  make(map[string]Check),
+		timeout: timeout,
+	}
+}
+
+// Health holds readiness checks
+type Health struct {
+	lock    *sync.RWMutex
+	checks  map[string]Check
+	timeout time.Duration
+}
+
+// Add registers readiness check. Same name overwrites the check.
+func (h *Health) Add(name string, c Check) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+	h.checks[name] = c
+}
+
+// Status is result of checks
+type Status struct {
+	Status string            `json:"status"`
+	Checks map[string]string `json:"checks,omitempty"`
+}
+
+// Ready runs all checks concurrently
+func (h *Health) Ready(ctx context.Context) (Status, bool) {
+	h.lock.RLock()
+	names := make([]string, 0, len(h.checks))
+	for k := range h.checks {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	checks := make([]Check, len(names))
+	for i, k := range names {
+		checks[i] = h.checks[k]
+	}
+	h.lock.RUnlock()
+
+	ctx, cancel := context.WithTimeout(ctx, h.timeout)
+	defer cancel()
+	results := make([]error, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c Check) {
+			defer wg.Done()
+			results[i] = c(ctx)
+		}(i, c)
+	}
+	wg.Wait()
+
+	st := Status{Status: "ok", Checks: make(map[string]string, len(names))}
+	ok := true
+	for i, k := range names {
+		if results[i] != nil {
+			ok = false
+			st.Checks[k] = results[i].Error()
+			continue
+		}
+		st.Checks[k] = "ok"
+	}
+	if !ok {
+		st.Status = "unavailable"
+	}
+	return st, ok
+}
+
+// Liveness responds 200 while the process is running.
+// Recommended to mount on "/healthz"
+func (h *Health) Liveness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Status{Status: "ok"})
+	})
+}
+
+// Readiness responds 503 until all checks pass.
+// Recommended to mount on "/readyz"
+func (h *Health) Readiness() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		st, ok := h.Ready(r.Context())
+		code := http.StatusOK
+		if !ok {
+			code = http.StatusServiceUnavailable
+		}
+		writeJSON(w, code, st)
+	})
+}
+
+// BuildInfo is version information of the binary
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildDate string `json:"build_date,omitempty"`
+	GoVersion string `json:"go_version"`
+}
+
+// BuildInfoHandler responds build information.
+// Recommended to mount on "/buildinfo"
+func BuildInfoHandler(b BuildInfo) http.Handler {
+	if len(b.GoVersion) < 1 {
+		b.GoVersion = runtime.Version()
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, b)
+	})
+}
+
+// Flag is check which passes after Set is called
+type Flag struct {
+	lock  sync.RWMutex
+	ready bool
+	err   error
+}
+
+// Set marks ready
+func (f *Flag) Set() {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.ready, f.err = true, nil
+}
+
+// Fail records reason of not ready
+func (f *Flag) Fail(err error) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.ready, f.err = false, err
+}
+
+// Check is Check of the flag
+func (f *Flag) Check(ctx context.Context) error {
+	f.lock.RLock()
+	defer f.lock.RUnlock()
+	if f.ready {
+		return nil
+	}
+	if f.err != nil {
+		return f.err
+	}
+	return errors.New("not ready")
+}
+
+// HTTPCheck passes when GET url responds 2xx
+func HTTPCheck(url string) Check {
+	return func(ctx context.Context) error {
+		req, err := http.NewRequest("GET", url, nil)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		res, err := http.DefaultClient.Do(req.WithContext(ctx))
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		res.Body.Close()
+		if res.StatusCode < 200 || res.StatusCode >= 300 {
+			return errors.Errorf("unexpected status %d", res.StatusCode)
+		}
+		return nil
+	}
+}
+
+// TCPCheck passes when the address accepts connection
+func TCPCheck(addr string) Check {
+	return func(ctx context.Context) error {
+		var d net.Dialer
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err != nil {
+			return errors.WithStack(err)
+		}
+		return conn.Close()
+	}
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
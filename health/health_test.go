@@ -0,0 +1,66 @@
+package health_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/health"
+)
+
+func TestReadiness(t *testing.T) {
+	hc := health.New(time.Second)
+	flag := &health.Flag{}
+	hc.Add("jwks", flag.Check)
+	hc.Add("session", func(ctx context.Context) error { return nil })
+
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer upstream.Close()
+	hc.Add("upstream", health.HTTPCheck(upstream.URL))
+
+	// not ready until flag is set
+	rec := httptest.NewRecorder()
+	hc.Readiness().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 503, rec.Code)
+	var st health.Status
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&st))
+	assert.Equal(t, "unavailable", st.Status)
+	assert.Equal(t, "not ready", st.Checks["jwks"])
+	assert.Equal(t, "ok", st.Checks["upstream"])
+
+	flag.Fail(errors.New("JWKS is not loaded"))
+	st, ok := hc.Ready(context.Background())
+	assert.False(t, ok)
+	assert.Equal(t, "JWKS is not loaded", st.Checks["jwks"])
+
+	flag.Set()
+	rec = httptest.NewRecorder()
+	hc.Readiness().ServeHTTP(rec, httptest.NewRequest("GET", "/readyz", nil))
+	assert.Equal(t, 200, rec.Code)
+
+	// upstream down
+	upstream.Close()
+	_, ok = hc.Ready(context.Background())
+	assert.False(t, ok)
+
+	// liveness does not depend on checks
+	rec = httptest.NewRecorder()
+	hc.Liveness().ServeHTTP(rec, httptest.NewRequest("GET", "/healthz", nil))
+	assert.Equal(t, 200, rec.Code)
+}
+
+func TestBuildInfo(t *testing.T) {
+	rec := httptest.NewRecorder()
+	h := health.BuildInfoHandler(health.BuildInfo{Version: "v1.2.3", Commit: "abcdef"})
+	h.ServeHTTP(rec, httptest.NewRequest("GET", "/buildinfo", nil))
+	var b health.BuildInfo
+	assert.NoError(t, json.NewDecoder(rec.Body).Decode(&b))
+	assert.Equal(t, "v1.2.3", b.Version)
+	assert.Equal(t, "abcdef", b.Commit)
+	assert.NotEmpty(t, b.GoVersion)
+}
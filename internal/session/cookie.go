@@ -0,0 +1,64 @@
+package session
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/pkg/errors"
+)
+
+// CookieConfig is attributes of session cookie
+type CookieConfig struct {
+	// Name is name of session cookie
+	Name string `json:"name" yaml:"name"`
+	// SameSite is one of "lax", "strict", "none" or "" as browser default.
+	// form_post callback from the provider is cross-site POST so that
+	// "lax" and "strict" drop the session cookie on callback.
+	SameSite string `json:"same_site" yaml:"same_site"`
+	Secure   bool   `json:"secure" yaml:"secure"`
+	Domain   string `json:"domain" yaml:"domain"`
+	Path     string `json:"path" yaml:"path"`
+	// MaxAge is seconds. 0 leaves store default.
+	MaxAge int `json:"max_age" yaml:"max_age"`
+}
+
+// SameSiteMode parses SameSite
+func (c CookieConfig) SameSiteMode() (http.SameSite, error) {
+	switch strings.ToLower(c.SameSite) {
+	case "":
+		return http.SameSiteDefaultMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "none":
+		if !c.Secure {
+			return 0, errors.Errorf("SameSite=None requires Secure")
+		}
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, errors.Errorf("Unknown SameSite [%s]", c.SameSite)
+}
+
+// Apply sets attributes to options of session store.
+// HttpOnly is always enabled.
+func (c CookieConfig) Apply(o *sessions.Options) error {
+	ss, err := c.SameSiteMode()
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	o.SameSite = ss
+	o.Secure = c.Secure
+	o.HttpOnly = true
+	if len(c.Domain) > 0 {
+		o.Domain = c.Domain
+	}
+	if len(c.Path) > 0 {
+		o.Path = c.Path
+	}
+	if c.MaxAge != 0 {
+		o.MaxAge = c.MaxAge
+	}
+	return nil
+}
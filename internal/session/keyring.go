@@ -0,0 +1,67 @@
+package session
+
+import (
+	"sync"
+
+	"github.com/gorilla/securecookie"
+	"github.com/pkg/errors"
+)
+
+// KeyRing is securecookie.Codec of which keys are replaced without restart.
+// Set it to Codecs of session store.
+type KeyRing struct {
+	lock   sync.RWMutex
+	codecs []securecookie.Codec
+	maxAge int
+}
+
+// NewKeyRing creates KeyRing with pairs of hash key and block key.
+// The first pair encodes and all pairs decode for rotation.
+func NewKeyRing(keyPairs ...[]byte) (*KeyRing, error) {
+	// default of securecookie
+	k := &KeyRing{maxAge: 86400 * 30}
+	return k, errors.WithStack(k.SetKeys(keyPairs...))
+}
+
+// SetKeys replaces keys
+func (k *KeyRing) SetKeys(keyPairs ...[]byte) error {
+	if len(keyPairs) < 1 || len(keyPairs[0]) < 1 {
+		return errors.Errorf("Hash key is required")
+	}
+	codecs := securecookie.CodecsFromPairs(keyPairs...)
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.codecs = codecs
+	k.applyMaxAge()
+	return nil
+}
+
+// MaxAge sets max age of cookie value in seconds
+func (k *KeyRing) MaxAge(age int) {
+	k.lock.Lock()
+	defer k.lock.Unlock()
+	k.maxAge = age
+	k.applyMaxAge()
+}
+
+func (k *KeyRing) applyMaxAge() {
+	for _, v := range k.codecs {
+		if sc, ok := v.(*securecookie.SecureCookie); ok {
+			sc.MaxAge(k.maxAge)
+		}
+	}
+}
+
+// Encode implements securecookie.Codec
+func (k *KeyRing) Encode(name string, value interface{}) (string, error) {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return securecookie.EncodeMulti(name, value, k.codecs...)
+}
+
+// Decode implements securecookie.Codec
+func (k *KeyRing) Decode(name, value string, dst interface{}) error {
+	k.lock.RLock()
+	defer k.lock.RUnlock()
+	return securecookie.DecodeMulti(name, value, dst, k.codecs...)
+}
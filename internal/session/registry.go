@@ -0,0 +1,135 @@
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// ErrNotFound is returned when the session is not registered
+var ErrNotFound = errors.New("session not found")
+
+// Record is logged in session
+type Record struct {
+	ID        string    `json:"id"`
+	Subject   string    `json:"sub"`
+	Username  string    `json:"username"`
+	LoginAt   time.Time `json:"login_at"`
+	LastSeen  time.Time `json:"last_seen"`
+	ExpireAt  time.Time `json:"expire_at"`
+	RemoteIP  string    `json:"remote_ip"`
+	UserAgent string    `json:"user_agent"`
+}
+
+// Registry holds logged in sessions independent of session store.
+// Session stores can not enumerate sessions nor delete them by user,
+// so authStore registers sessions and checks revocation on load.
+// Implement it on shared storage when proxies are replicated.
+type Registry interface {
+	// Set adds or updates the record
+	Set(ctx context.Context, rec Record) error
+	// Touch updates last seen of the session
+	Touch(ctx context.Context, id string, at time.Time) error
+	// Remove removes the record without revocation
+	Remove(ctx context.Context, id string) error
+	// List returns records which are not expired
+	List(ctx context.Context) ([]Record, error)
+	// Revoke removes the record and rejects the session until expired
+	Revoke(ctx context.Context, id string) error
+	// Revoked reports the session is revoked
+	Revoked(ctx context.Context, id string) (bool, error)
+}
+
+// NewMemoryRegistry creates Registry on memory of the process
+func NewMemoryRegistry() Registry {
+	return &memoryRegistry{
+		lock:    new(sync.Mutex),
+		data:    make(map[string]Record),
+		revoked: make(map[string]time.Time),
+	}
+}
+
+type memoryRegistry struct {
+	lock    *sync.Mutex
+	data    map[string]Record
+	revoked map[string]time.Time
+}
+
+func (m *memoryRegistry) Set(ctx context.Context, rec Record) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.data[rec.ID] = rec
+	return nil
+}
+
+func (m *memoryRegistry) Touch(ctx context.Context, id string, at time.Time) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	if rec, ok := m.data[id]; ok {
+		rec.LastSeen = at
+		m.data[id] = rec
+	}
+	return nil
+}
+
+func (m *memoryRegistry) Remove(ctx context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	delete(m.data, id)
+	return nil
+}
+
+// List removes expired sessions and returns remains in order of login
+func (m *memoryRegistry) List(ctx context.Context) ([]Record, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := time.Now()
+	list := make([]Record, 0, len(m.data))
+	for k, v := range m.data {
+		if now.After(v.ExpireAt) {
+			delete(m.data, k)
+			continue
+		}
+		list = append(list, v)
+	}
+	for k, v := range m.revoked {
+		if now.After(v) {
+			delete(m.revoked, k)
+		}
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].LoginAt.Before(list[j].LoginAt)
+	})
+	return list, nil
+}
+
+func (m *memoryRegistry) Revoke(ctx context.Context, id string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	rec, ok := m.data[id]
+	if !ok {
+		return ErrNotFound
+	}
+	m.revoked[id] = rec.ExpireAt
+	delete(m.data, id)
+	return nil
+}
+
+func (m *memoryRegistry) Revoked(ctx context.Context, id string) (bool, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	_, ok := m.revoked[id]
+	return ok, nil
+}
+
+// newSessionID generates random id which is independent of session backend
+func newSessionID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
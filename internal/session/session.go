@@ -13,6 +13,8 @@ import (
 var (
 	// Identity key of auth info
 	skAuthInfo = "authinfo"
+	// Identity key of session id
+	skSessionID = "sid"
 )
 
 func init() {
@@ -28,15 +30,43 @@ type AuthInfo struct {
 	LoginReferer        string    // Login前にアクセスしていたページ
 	ExpireAt            time.Time // 現在のトークン有効期限
 	IDToken             string    // IDToken
+	Subject             string    // sub of IDToken
+	Username            string    // 表示用のユーザー名
+	Claims              string    // 検証済みIDTokenのclaims(JSON)
+	AccessToken         string    // userinfoの取得に使うAccessToken
+	UserInfo            string    // userinfoのclaims(JSON)
+	UserInfoAt          time.Time // userinfoを取得した時刻
+	LoginAt             time.Time // Loginが完了した時刻
+	LastAccessAt        time.Time // 認証が必要なルートへの最終アクセス時刻
+	AuthTime            time.Time // IdPで認証した時刻(auth_time)
+	MaxAge              int       // 次のLoginで要求するmax_age(秒)
+	RemoteIP            string    // Login時のクライアントIP
+	UserAgent           string    // Login時のUser-Agent
+	Bearer              bool      // Bearer tokenで認証した要求。Sessionには保存しない
+}
+
+// StoreOption is optional setting of AuthStore
+type StoreOption func(*authStore)
+
+// WithRegistry sets Registry of logged in sessions. default is on memory.
+func WithRegistry(reg Registry) StoreOption {
+	return func(a *authStore) {
+		a.registry = reg
+	}
 }
 
 // NewAuthStore make AutuStore
-func NewAuthStore(store sessions.Store, sessionName string, contextKey interface{}) AuthStore {
-	return &authStore{
+func NewAuthStore(store sessions.Store, sessionName string, contextKey interface{}, opts ...StoreOption) AuthStore {
+	a := &authStore{
 		store:       store,
 		sessionName: sessionName,
 		contextKey:  contextKey,
+		registry:    NewMemoryRegistry(),
 	}
+	for _, opt := range opts {
+		opt(a)
+	}
+	return a
 }
 
 // AuthStore deals Authorication information between implement
@@ -44,12 +74,30 @@ func NewAuthStore(store sessions.Store, sessionName string, contextKey interface
 type AuthStore interface {
 	Handler() func(next http.Handler) http.Handler
 	Save(w http.ResponseWriter, r *http.Request, info *AuthInfo) error
+	// Renew discards current session and saves info to session of new id.
+	// Use on login, logout and privilege change to prevent session fixation.
+	Renew(w http.ResponseWriter, r *http.Request, info *AuthInfo) error
+	// Name returns session name which is used as cookie name
+	Name() string
+	// Active returns number of logged in sessions which are not expired
+	Active() int
+	// Ping checks session backend is reachable
+	Ping(ctx context.Context) error
+	// SessionID returns id of current session. empty when not saved yet.
+	SessionID(r *http.Request) string
+	// Sessions returns logged in sessions
+	Sessions(ctx context.Context) ([]Record, error)
+	// Revoke logs out the session on next request
+	Revoke(ctx context.Context, id string) error
+	// RevokeSubject logs out all sessions of the user and returns revoked records
+	RevokeSubject(ctx context.Context, sub string) ([]Record, error)
 }
 
 type authStore struct {
 	store       sessions.Store
 	sessionName string
 	contextKey  interface{}
+	registry    Registry
 }
 
 // Handler generates http middlerware handler for session generate and assing to context
@@ -67,6 +115,19 @@ func (a *authStore) Handler() func(next http.Handler) http.Handler {
 			if ok {
 				ai = x
 			}
+			if sid, ok := ses.Values[skSessionID].(string); ok && ai.LoggedIn {
+				revoked, err := a.registry.Revoked(r.Context(), sid)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusInternalServerError)
+					return
+				}
+				if revoked {
+					// treat as logged out
+					ai = AuthInfo{}
+				} else {
+					a.registry.Touch(r.Context(), sid, time.Now())
+				}
+			}
 			ctx := r.Context()
 			ctx = context.WithValue(ctx, a.contextKey, &ai)
 			next.ServeHTTP(w, r.WithContext(ctx))
@@ -75,13 +136,159 @@ func (a *authStore) Handler() func(next http.Handler) http.Handler {
 	}
 }
 
-// Handler generates http middlerware handler for session generate and assing to context
+// Save saves authinfo to current session
 func (a *authStore) Save(w http.ResponseWriter, r *http.Request, info *AuthInfo) error {
+	if info.Bearer {
+		return nil
+	}
 	ses, err := a.store.Get(r, a.sessionName)
 	if err != nil {
 		return errors.WithStack(err)
 	}
+	return a.save(w, r, ses, info)
+}
+
+// Renew destroys server-side data of current session
+// and saves only authinfo to new session id
+func (a *authStore) Renew(w http.ResponseWriter, r *http.Request, info *AuthInfo) error {
+	if info.Bearer {
+		return nil
+	}
+	ses, err := a.store.Get(r, a.sessionName)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if sid, ok := ses.Values[skSessionID].(string); ok {
+		if err := a.registry.Remove(r.Context(), sid); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	if !ses.IsNew {
+		if err := a.destroy(r, ses); err != nil {
+			return errors.WithStack(err)
+		}
+	}
+	// reuse registered session to be returned by following Get in the request
+	ses.ID = ""
+	ses.IsNew = true
+	ses.Values = make(map[interface{}]interface{})
+	return a.save(w, r, ses, info)
+}
+
+func (a *authStore) save(w http.ResponseWriter, r *http.Request, ses *sessions.Session, info *AuthInfo) error {
+	sid, ok := ses.Values[skSessionID].(string)
+	if !ok {
+		sid = newSessionID()
+		ses.Values[skSessionID] = sid
+	}
 	ses.Values[skAuthInfo] = *info
-	err = ses.Save(r, w)
+	err := ses.Save(r, w)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	if !info.LoggedIn {
+		return errors.WithStack(a.registry.Remove(r.Context(), sid))
+	}
+	return errors.WithStack(a.registry.Set(r.Context(), Record{
+		ID:        sid,
+		Subject:   info.Subject,
+		Username:  info.Username,
+		LoginAt:   info.LoginAt,
+		LastSeen:  time.Now(),
+		ExpireAt:  info.ExpireAt,
+		RemoteIP:  info.RemoteIP,
+		UserAgent: info.UserAgent,
+	}))
+}
+
+// destroy removes server-side data of the session.
+// Values are overwritten before deletion because some stores
+// do not delete by MaxAge. Cookies are not written to the response.
+func (a *authStore) destroy(r *http.Request, ses *sessions.Session) error {
+	old := sessions.NewSession(a.store, a.sessionName)
+	old.ID = ses.ID
+	opts := sessions.Options{Path: "/"}
+	if ses.Options != nil {
+		opts = *ses.Options
+	}
+	old.Options = &opts
+	w := &discardWriter{header: make(http.Header)}
+	if err := a.store.Save(r, w, old); err != nil {
+		return errors.WithStack(err)
+	}
+	opts.MaxAge = -1
+	return errors.WithStack(a.store.Save(r, w, old))
+}
+
+// Name returns session name
+func (a *authStore) Name() string {
+	return a.sessionName
+}
+
+// Active returns number of logged in sessions
+func (a *authStore) Active() int {
+	list, err := a.registry.List(context.Background())
+	if err != nil {
+		return 0
+	}
+	return len(list)
+}
+
+// SessionID returns id of current session
+func (a *authStore) SessionID(r *http.Request) string {
+	ses, err := a.store.Get(r, a.sessionName)
+	if err != nil {
+		return ""
+	}
+	sid, _ := ses.Values[skSessionID].(string)
+	return sid
+}
+
+// Sessions returns logged in sessions
+func (a *authStore) Sessions(ctx context.Context) ([]Record, error) {
+	list, err := a.registry.List(ctx)
+	return list, errors.WithStack(err)
+}
+
+// Revoke logs out the session
+func (a *authStore) Revoke(ctx context.Context, id string) error {
+	return errors.WithStack(a.registry.Revoke(ctx, id))
+}
+
+// RevokeSubject logs out all sessions of the user
+func (a *authStore) RevokeSubject(ctx context.Context, sub string) ([]Record, error) {
+	list, err := a.registry.List(ctx)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	var revoked []Record
+	for _, v := range list {
+		if v.Subject != sub {
+			continue
+		}
+		if err := a.registry.Revoke(ctx, v.ID); err != nil && errors.Cause(err) != ErrNotFound {
+			return revoked, errors.WithStack(err)
+		}
+		revoked = append(revoked, v)
+	}
+	return revoked, nil
+}
+
+// Ping loads new session from backend
+func (a *authStore) Ping(ctx context.Context) error {
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	_, err = a.store.New(r.WithContext(ctx), a.sessionName)
 	return errors.WithStack(err)
 }
+
+// discardWriter is ResponseWriter which drops all output
+type discardWriter struct {
+	header http.Header
+}
+
+func (d *discardWriter) Header() http.Header         { return d.header }
+func (d *discardWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (d *discardWriter) WriteHeader(int)             {}
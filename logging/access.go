@@ -0,0 +1,88 @@
+// Package logging writes structured access log and audit log of security events.
+package logging
+
+import (
+	"context"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+)
+
+type contextKey struct {
+	name string
+}
+
+var (
+	// entryKey holds fields which are decided in following handlers
+	entryKey = &contextKey{"accesslog"}
+)
+
+type entry struct {
+	lock     sync.Mutex
+	upstream string
+	sub      string
+	username string
+}
+
+// SetUpstream records upstream of the request to access log
+func SetUpstream(ctx context.Context, upstream string) {
+	if e, ok := ctx.Value(entryKey).(*entry); ok {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		e.upstream = upstream
+	}
+}
+
+// SetUser records authenticated user of the request to access log
+func SetUser(ctx context.Context, sub, username string) {
+	if e, ok := ctx.Value(entryKey).(*entry); ok {
+		e.lock.Lock()
+		defer e.lock.Unlock()
+		e.sub = sub
+		e.username = username
+	}
+}
+
+// AccessLog writes a line per request with method, path, status, latency,
+// upstream, bytes, request id and authenticated user.
+// clientIP resolves ip address of the client. RemoteAddr is used when nil.
+func AccessLog(l logrus.FieldLogger, clientIP func(r *http.Request) string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			e := &entry{}
+			ww := middleware.NewWrapResponseWriter(w, r.ProtoMajor)
+			r = r.WithContext(context.WithValue(r.Context(), entryKey, e))
+			defer func() {
+				ip := r.RemoteAddr
+				if clientIP != nil {
+					ip = clientIP(r)
+				}
+				status := ww.Status()
+				if status == 0 {
+					status = http.StatusOK
+				}
+				e.lock.Lock()
+				defer e.lock.Unlock()
+				l.WithFields(logrus.Fields{
+					"type":       "access",
+					"method":     r.Method,
+					"path":       r.URL.Path,
+					"status":     status,
+					"latency_ms": float64(time.Since(start)) / float64(time.Millisecond),
+					"bytes":      ww.BytesWritten(),
+					"upstream":   e.upstream,
+					"request_id": middleware.GetReqID(r.Context()),
+					"remote_ip":  ip,
+					"sub":        e.sub,
+					"username":   e.username,
+				}).Info("access")
+			}()
+			next.ServeHTTP(ww, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,98 @@
+package logging
+
+import (
+	"io"
+	"net/http"
+	"os"
+
+	"github.com/go-chi/chi/middleware"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Event is kind of security event
+type Event string
+
+// Security events of audit log
+const (
+	EventLoginSuccess        Event = "login_success"
+	EventLoginFailure        Event = "login_failure"
+	EventLogout              Event = "logout"
+	EventSessionRevoked      Event = "session_revoked"
+	EventAuthorizationDenied Event = "authorization_denied"
+)
+
+// AuditConfig is output setting of audit log
+type AuditConfig struct {
+	// Output is "stdout" or path of file. Audit log is disabled when empty.
+	Output string `json:"output" yaml:"output"`
+	// MaxSize is megabytes of file before rotated
+	MaxSize int `json:"max_size" yaml:"max_size"`
+	// MaxBackups is number of rotated files to retain
+	MaxBackups int `json:"max_backups" yaml:"max_backups"`
+	// MaxAge is days to retain rotated files
+	MaxAge   int  `json:"max_age" yaml:"max_age"`
+	Compress bool `json:"compress" yaml:"compress"`
+}
+
+// Auditor writes security events as JSON lines.
+// nil Auditor discards all events.
+type Auditor struct {
+	l *logrus.Logger
+	w io.Closer
+}
+
+// NewAuditor creates Auditor which writes to the output of config
+func NewAuditor(c AuditConfig) *Auditor {
+	var w io.Writer
+	var closer io.Closer
+	switch c.Output {
+	case "":
+		return nil
+	case "stdout":
+		w = os.Stdout
+	default:
+		lj := &lumberjack.Logger{
+			Filename:   c.Output,
+			MaxSize:    c.MaxSize,
+			MaxBackups: c.MaxBackups,
+			MaxAge:     c.MaxAge,
+			Compress:   c.Compress,
+		}
+		w, closer = lj, lj
+	}
+	return NewAuditorWriter(w, closer)
+}
+
+// NewAuditorWriter creates Auditor which writes to w
+func NewAuditorWriter(w io.Writer, closer io.Closer) *Auditor {
+	l := logrus.New()
+	l.SetOutput(w)
+	l.SetFormatter(&logrus.JSONFormatter{})
+	return &Auditor{l: l, w: closer}
+}
+
+// Log writes event of the request
+func (a *Auditor) Log(r *http.Request, ev Event, fields logrus.Fields) {
+	if a == nil {
+		return
+	}
+	f := logrus.Fields{
+		"type":       "audit",
+		"event":      ev,
+		"request_id": middleware.GetReqID(r.Context()),
+		"user_agent": r.UserAgent(),
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	a.l.WithFields(f).Info(string(ev))
+}
+
+// Close closes output file
+func (a *Auditor) Close() error {
+	if a == nil || a.w == nil {
+		return nil
+	}
+	return a.w.Close()
+}
@@ -0,0 +1,69 @@
+package logging_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/logging"
+)
+
+func TestAccessLog(t *testing.T) {
+	buf := new(bytes.Buffer)
+	l := logrus.New()
+	l.SetOutput(buf)
+	l.SetFormatter(&logrus.JSONFormatter{})
+
+	h := logging.AccessLog(l, nil)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUpstream(r.Context(), "localhost:8080")
+		logging.SetUser(r.Context(), "248289761001", "janedoe")
+		w.WriteHeader(201)
+		w.Write([]byte("hello"))
+	}))
+	req := httptest.NewRequest("POST", "/api/items", nil)
+	req.Header.Set("X-Request-Id", "req-1")
+	logging.RequestID(h).ServeHTTP(httptest.NewRecorder(), req)
+
+	var m map[string]interface{}
+	checkError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equal(t, "POST", m["method"])
+	assert.Equal(t, "/api/items", m["path"])
+	assert.Equal(t, float64(201), m["status"])
+	assert.Equal(t, float64(5), m["bytes"])
+	assert.Equal(t, "localhost:8080", m["upstream"])
+	// request id of the client is not trusted
+	assert.NotEqual(t, "req-1", m["request_id"])
+	assert.Len(t, m["request_id"], 32)
+	assert.Equal(t, "248289761001", m["sub"])
+	assert.Equal(t, "janedoe", m["username"])
+	assert.Contains(t, m, "latency_ms")
+}
+
+func TestAuditor(t *testing.T) {
+	buf := new(bytes.Buffer)
+	a := logging.NewAuditorWriter(buf, nil)
+	req := httptest.NewRequest("POST", "/cb", nil)
+	a.Log(req, logging.EventLoginFailure, logrus.Fields{"reason": "nonce"})
+
+	var m map[string]interface{}
+	checkError(t, json.Unmarshal(buf.Bytes(), &m))
+	assert.Equal(t, "audit", m["type"])
+	assert.Equal(t, "login_failure", m["event"])
+	assert.Equal(t, "nonce", m["reason"])
+
+	// nil Auditor discards events
+	var na *logging.Auditor
+	na.Log(req, logging.EventLogout, nil)
+	assert.Nil(t, logging.NewAuditor(logging.AuditConfig{}))
+}
+
+func checkError(t *testing.T, err error) {
+	if err != nil {
+		t.Logf("%+v", err)
+		t.FailNow()
+	}
+}
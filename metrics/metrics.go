@@ -0,0 +1,125 @@
+// Package metrics exposes behaviour of the proxy in Prometheus text format.
+// Metric names and labels are part of public interface. Do not rename them.
+package metrics
+
+import (
+	"net/http"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "authproxy"
+
+var (
+	// Registry holds all metrics of authproxy
+	Registry = prometheus.NewRegistry()
+
+	loginAttempts = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_attempts_total",
+		Help:      "Number of authentication responses received on callback.",
+	})
+	loginSuccess = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_success_total",
+		Help:      "Number of succeeded logins.",
+	})
+	loginFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "login_failures_total",
+		Help:      "Number of failed logins by reason.",
+	}, []string{"reason"})
+	jwksFetch = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "jwks_fetch_total",
+		Help:      "Number of JWKS fetches by result.",
+	}, []string{"result"})
+	proxyRequests = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "proxy_requests_total",
+		Help:      "Number of proxied requests by upstream, status code and method.",
+	}, []string{"upstream", "code", "method"})
+	proxyDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "proxy_request_duration_seconds",
+		Help:      "Latency of proxied requests by upstream, status code and method.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"upstream", "code", "method"})
+
+	activeSessionsMu sync.Mutex
+	activeSessions   func() int
+)
+
+func init() {
+	Registry.MustRegister(
+		prometheus.NewGoCollector(),
+		prometheus.NewProcessCollector(prometheus.ProcessCollectorOpts{}),
+		loginAttempts,
+		loginSuccess,
+		loginFailures,
+		jwksFetch,
+		proxyRequests,
+		proxyDuration,
+		prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+			Namespace: namespace,
+			Name:      "active_sessions",
+			Help:      "Number of logged in sessions which are not expired.",
+		}, countActiveSessions),
+	)
+}
+
+// Handler serves metrics in Prometheus text format.
+// Recommended to mount on "/metrics"
+func Handler() http.Handler {
+	return promhttp.HandlerFor(Registry, promhttp.HandlerOpts{})
+}
+
+// ObserveLoginAttempt counts authentication response
+func ObserveLoginAttempt() {
+	loginAttempts.Inc()
+}
+
+// ObserveLogin counts result of login.
+// reason is ignored when login is succeeded.
+func ObserveLogin(ok bool, reason string) {
+	if ok {
+		loginSuccess.Inc()
+		return
+	}
+	loginFailures.WithLabelValues(reason).Inc()
+}
+
+// ObserveJWKSFetch counts result of fetching JWKS
+func ObserveJWKSFetch(err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	jwksFetch.WithLabelValues(result).Inc()
+}
+
+// SetActiveSessions sets function which counts active sessions
+func SetActiveSessions(f func() int) {
+	activeSessionsMu.Lock()
+	defer activeSessionsMu.Unlock()
+	activeSessions = f
+}
+
+func countActiveSessions() float64 {
+	activeSessionsMu.Lock()
+	defer activeSessionsMu.Unlock()
+	if activeSessions == nil {
+		return 0
+	}
+	return float64(activeSessions())
+}
+
+// InstrumentProxy counts requests and observes latency of proxied requests
+func InstrumentProxy(upstream string, next http.Handler) http.Handler {
+	l := prometheus.Labels{"upstream": upstream}
+	return promhttp.InstrumentHandlerDuration(proxyDuration.MustCurryWith(l),
+		promhttp.InstrumentHandlerCounter(proxyRequests.MustCurryWith(l), next),
+	)
+}
@@ -0,0 +1,48 @@
+package metrics_test
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/metrics"
+)
+
+func TestHandler(t *testing.T) {
+	metrics.ObserveLoginAttempt()
+	metrics.ObserveLogin(true, "")
+	metrics.ObserveLogin(false, "nonce")
+	metrics.ObserveJWKSFetch(nil)
+	metrics.ObserveJWKSFetch(errors.New("timeout"))
+	metrics.SetActiveSessions(func() int { return 3 })
+
+	h := metrics.InstrumentProxy("localhost:8080", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(502)
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+
+	rec := httptest.NewRecorder()
+	metrics.Handler().ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	b, err := ioutil.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := string(b)
+
+	expects := []string{
+		"authproxy_login_attempts_total 1",
+		"authproxy_login_success_total 1",
+		`authproxy_login_failures_total{reason="nonce"} 1`,
+		`authproxy_jwks_fetch_total{result="success"} 1`,
+		`authproxy_jwks_fetch_total{result="failure"} 1`,
+		"authproxy_active_sessions 3",
+		`authproxy_proxy_requests_total{code="502",method="get",upstream="localhost:8080"} 1`,
+		`authproxy_proxy_request_duration_seconds_count{code="502",method="get",upstream="localhost:8080"} 1`,
+	}
+	for _, v := range expects {
+		assert.Contains(t, body, v)
+	}
+}
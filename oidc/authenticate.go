@@ -5,6 +5,7 @@ import (
 	"net/http"
 	"net/url"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/lestrrat-go/jwx/jwk"
@@ -12,10 +13,14 @@ import (
 	"github.com/dgrijalva/jwt-go"
 	"github.com/pkg/errors"
 	"github.com/uzuna/go-authproxy/internal/nonce"
+	"github.com/uzuna/go-authproxy/metrics"
+	"github.com/uzuna/go-authproxy/secret"
+	"github.com/uzuna/go-authproxy/tracing"
 )
 
 func NewAuthenticator(c *Config) (Authenticator, error) {
 	set, err := jwk.FetchHTTP(c.JWKURL)
+	metrics.ObserveJWKSFetch(err)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
@@ -23,17 +28,40 @@ func NewAuthenticator(c *Config) (Authenticator, error) {
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	return newAuthenticator(c, kf, nonce.NewStore(time.Second*60)), nil
+}
+
+func newAuthenticator(c *Config, kf jwt.Keyfunc, ns nonce.Store) *authenticator {
 	return &authenticator{
-		ns:      nonce.NewStore(time.Second * 60),
+		ns:      ns,
 		config:  c,
 		keyfunc: kf,
-	}, nil
+		v:       newConfigValidator(c, ns),
+	}
 }
 
 type authenticator struct {
 	ns      nonce.Store
+	mu      sync.RWMutex
 	config  *Config
 	keyfunc jwt.Keyfunc
+	v       *IDTokenValidator
+}
+
+// conf returns current config
+func (a *authenticator) conf() *Config {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.config
+}
+
+// SetClientSecret replaces client_secret of a copy of the config
+func (a *authenticator) SetClientSecret(v secret.Value) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	c := *a.config
+	c.ClientSecret = v
+	a.config = &c
 }
 
 // AuthURL gengerates Authorize url
@@ -44,7 +72,7 @@ func (a *authenticator) AuthURL(state string, opts ...URLOptionalParameter) (str
 	}
 
 	// build URL
-	c := a.config
+	c := a.conf()
 	var buf bytes.Buffer
 	buf.WriteString(c.Endpoint.AuthURL)
 
@@ -74,25 +102,21 @@ func (a *authenticator) AuthURL(state string, opts ...URLOptionalParameter) (str
 }
 
 func (a *authenticator) Authenticate(r *http.Request) (*AuthResponse, error) {
+	_, span := tracing.Start(r.Context(), "ParseAuthResponse")
 	ares, err := ParseAuthResponse(r)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
+	_, span = tracing.Start(r.Context(), "VerifyIDToken")
 	claims, err := ParseIDToken(ares.IDToken, a.keyfunc)
+	tracing.End(span, err)
 	if err != nil {
 		return nil, errors.WithStack(err)
 	}
 
-	if !a.ns.CheckOnce(claims.Nonce) {
-		return nil, errors.Errorf("Invalid nonce")
-	}
-
-	if claims.Audience != a.config.ClientID {
-		return nil, errors.Errorf("Unacceptable Audience [%s]", claims.Audience)
-	}
-
-	if checkIssers(a.config.Issuers, claims.Issuer) {
-		return nil, errors.Errorf("Unacceptable Issuer [%s]", claims.Issuer)
+	if err := a.v.Validate(claims); err != nil {
+		return nil, err
 	}
 
 	ares.Claims = claims
@@ -105,15 +129,3 @@ func (a *authenticator) Authenticate(r *http.Request) (*AuthResponse, error) {
 
 	return ares, nil
 }
-
-func checkIssers(list []string, iss string) bool {
-	if len(list) < 1 {
-		return true
-	}
-	for _, v := range list {
-		if v == iss {
-			return true
-		}
-	}
-	return false
-}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/secret"
 )
 
 const (
@@ -42,6 +43,15 @@ func TestAuthenticate(t *testing.T) {
 	assert.Equal(t, referenceURL, authURL)
 }
 
+func TestSetClientSecret(t *testing.T) {
+	c := &Config{ClientID: "s6BhdRkqt3", ClientSecret: "old"}
+	a := newAuthenticator(c, nil, &DummyNonceStore{})
+	a.SetClientSecret("new")
+	assert.Equal(t, secret.Value("new"), a.conf().ClientSecret)
+	// config of the caller is not modified
+	assert.Equal(t, secret.Value("old"), c.ClientSecret)
+}
+
 type DummyNonceStore struct{}
 
 func (s *DummyNonceStore) Get() string {
@@ -0,0 +1,122 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// TokenResponse is successful response of token endpoint
+type TokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int    `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	IDToken      string `json:"id_token"`
+}
+
+// TokenError is error response of token endpoint. RFC 6749 5.2
+type TokenError struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description"`
+}
+
+func (e *TokenError) Error() string {
+	if len(e.Description) > 0 {
+		return e.Code + ": " + e.Description
+	}
+	return e.Code
+}
+
+// PKCE is code_verifier and S256 code_challenge of RFC 7636
+type PKCE struct {
+	Verifier  string
+	Challenge string
+}
+
+// NewPKCE generates random code_verifier
+func NewPKCE() (*PKCE, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	v := base64.RawURLEncoding.EncodeToString(b)
+	sum := sha256.Sum256([]byte(v))
+	return &PKCE{Verifier: v, Challenge: base64.RawURLEncoding.EncodeToString(sum[:])}, nil
+}
+
+// URLParams returns parameters of authorization request
+func (p *PKCE) URLParams() []URLOptionalParameter {
+	return []URLOptionalParameter{
+		SetURLParam("code_challenge", p.Challenge),
+		SetURLParam("code_challenge_method", "S256"),
+	}
+}
+
+// ExchangeCode requests tokens of authorization code at token endpoint.
+// verifier is code_verifier of PKCE. Empty when PKCE is not used.
+func ExchangeCode(ctx context.Context, hc *http.Client, c *Config, code, redirectURI, verifier string) (*TokenResponse, error) {
+	form := url.Values{
+		"grant_type":   {"authorization_code"},
+		"code":         {code},
+		"redirect_uri": {redirectURI},
+	}
+	if len(verifier) > 0 {
+		form.Set("code_verifier", verifier)
+	}
+	return requestToken(ctx, hc, c, form)
+}
+
+// requestToken posts form to token endpoint
+func requestToken(ctx context.Context, hc *http.Client, c *Config, form url.Values) (*TokenResponse, error) {
+	if len(c.Endpoint.TokenURL) < 1 {
+		return nil, errors.Errorf("token_url is empty")
+	}
+	var tr TokenResponse
+	if err := postForm(ctx, hc, c, c.Endpoint.TokenURL, form, &tr); err != nil {
+		return nil, err
+	}
+	return &tr, nil
+}
+
+// postForm posts form with client authentication and decodes JSON response to v.
+// client_secret_basic is used for confidential client.
+// Error response of RFC 6749 5.2 is returned as *TokenError.
+func postForm(ctx context.Context, hc *http.Client, c *Config, endpoint string, form url.Values, v interface{}) error {
+	if hc == nil {
+		hc = http.DefaultClient
+	}
+	if len(c.ClientSecret) < 1 {
+		form.Set("client_id", c.ClientID)
+	}
+	req, err := http.NewRequest("POST", endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", expectContentType)
+	req.Header.Set("Accept", "application/json")
+	if len(c.ClientSecret) > 0 {
+		// RFC 6749 2.3.1 encodes the credentials before basic auth
+		req.SetBasicAuth(url.QueryEscape(c.ClientID), url.QueryEscape(string(c.ClientSecret)))
+	}
+	res, err := hc.Do(req.WithContext(ctx))
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		var te TokenError
+		if err := json.NewDecoder(res.Body).Decode(&te); err != nil || len(te.Code) < 1 {
+			return errors.Errorf("%s responds status %d", endpoint, res.StatusCode)
+		}
+		return &te
+	}
+	return errors.WithStack(json.NewDecoder(res.Body).Decode(v))
+}
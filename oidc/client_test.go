@@ -0,0 +1,64 @@
+package oidc
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExchangeCode(t *testing.T) {
+	pkce, err := NewPKCE()
+	checkError(t, err)
+	sum := sha256.Sum256([]byte(pkce.Verifier))
+	assert.Equal(t, base64.RawURLEncoding.EncodeToString(sum[:]), pkce.Challenge)
+
+	var got *http.Request
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		got = r
+		w.Header().Set("Content-Type", "application/json")
+		if r.PostForm.Get("code") != "good" {
+			w.WriteHeader(400)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant", "error_description": "unknown code"})
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"id_token": "x.y.z", "token_type": "Bearer", "expires_in": 60})
+	}))
+	defer ts.Close()
+
+	// public client
+	c := &Config{ClientID: "cli", Endpoint: Endpoint{TokenURL: ts.URL}}
+	tr, err := ExchangeCode(context.Background(), nil, c, "good", "http://127.0.0.1:1/callback", pkce.Verifier)
+	checkError(t, err)
+	assert.Equal(t, "x.y.z", tr.IDToken)
+	assert.Equal(t, 60, tr.ExpiresIn)
+	assert.Equal(t, "authorization_code", got.PostForm.Get("grant_type"))
+	assert.Equal(t, "cli", got.PostForm.Get("client_id"))
+	assert.Equal(t, pkce.Verifier, got.PostForm.Get("code_verifier"))
+	_, _, basic := got.BasicAuth()
+	assert.False(t, basic)
+
+	// confidential client
+	c.ClientSecret = "s e/cret"
+	_, err = ExchangeCode(context.Background(), nil, c, "good", "http://127.0.0.1:1/callback", "")
+	checkError(t, err)
+	id, secret, _ := got.BasicAuth()
+	assert.Equal(t, "cli", id)
+	assert.Equal(t, "s+e%2Fcret", secret)
+	assert.Empty(t, got.PostForm.Get("client_id"))
+	assert.Empty(t, got.PostForm.Get("code_verifier"))
+
+	// error response
+	_, err = ExchangeCode(context.Background(), nil, c, "bad", "http://127.0.0.1:1/callback", "")
+	te, ok := err.(*TokenError)
+	if assert.True(t, ok) {
+		assert.Equal(t, "invalid_grant", te.Code)
+		assert.Equal(t, "invalid_grant: unknown code", te.Error())
+	}
+}
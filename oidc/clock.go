@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"time"
+)
+
+// DefaultLeeway is allowed clock difference when Config.Leeway is not set
+const DefaultLeeway = time.Second * 30
+
+// TimeValidator checks exp, nbf, iat and auth_time
+// with allowed clock difference between the provider and the host
+type TimeValidator struct {
+	Leeway time.Duration
+	// Now returns current time. default is time.Now
+	Now func() time.Time
+}
+
+// NewTimeValidator creates TimeValidator. Zero leeway allows no clock difference.
+func NewTimeValidator(leeway time.Duration) *TimeValidator {
+	return &TimeValidator{Leeway: leeway}
+}
+
+func (v *TimeValidator) now() time.Time {
+	if v.Now != nil {
+		return v.Now()
+	}
+	return time.Now()
+}
+
+// CheckExpiry rejects exp before now over the leeway
+func (v *TimeValidator) CheckExpiry(exp time.Time) error {
+	if now := v.now(); now.Sub(exp) > v.Leeway {
+		return &TimeError{Claim: "exp", Time: exp, Now: now, Leeway: v.Leeway}
+	}
+	return nil
+}
+
+// CheckNotBefore rejects nbf after now over the leeway. Zero nbf is accepted.
+func (v *TimeValidator) CheckNotBefore(nbf time.Time) error {
+	if nbf.IsZero() {
+		return nil
+	}
+	if now := v.now(); nbf.Sub(now) > v.Leeway {
+		return &TimeError{Claim: "nbf", Time: nbf, Now: now, Leeway: v.Leeway}
+	}
+	return nil
+}
+
+// CheckIssuedAt rejects iat after now over the leeway
+func (v *TimeValidator) CheckIssuedAt(iat time.Time) error {
+	if now := v.now(); iat.Sub(now) > v.Leeway {
+		return &TimeError{Claim: "iat", Time: iat, Now: now, Leeway: v.Leeway}
+	}
+	return nil
+}
+
+// ValidateAuthTime checks authentication at the provider is within maxAge.
+// openid-connect-core-1.0 3.1.2.1 max_age
+func (v *TimeValidator) ValidateAuthTime(authTime time.Time, maxAge time.Duration) error {
+	if authTime.IsZero() {
+		return authErrorf(ReasonAuthTime, "Not found auth_time")
+	}
+	now := v.now()
+	if now.Sub(authTime) > maxAge+v.Leeway || authTime.Sub(now) > v.Leeway {
+		return &TimeError{Claim: "auth_time", Time: authTime, Now: now, Leeway: v.Leeway, MaxAge: maxAge}
+	}
+	return nil
+}
+
+// Expired reports exp is past over the leeway
+func (v *TimeValidator) Expired(exp time.Time) bool {
+	return v.CheckExpiry(exp) != nil
+}
+
+// unixTime converts NumericDate. zero when not set.
+func unixTime(sec int64) time.Time {
+	if sec < 1 {
+		return time.Time{}
+	}
+	return time.Unix(sec, 0)
+}
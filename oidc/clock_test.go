@@ -0,0 +1,81 @@
+package oidc
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeValidator(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	v := &TimeValidator{Leeway: time.Second * 30, Now: func() time.Time { return now }}
+	at := func(d time.Duration) time.Time { return now.Add(d) }
+	hour := time.Hour
+
+	for _, c := range []struct {
+		name   string
+		err    error
+		reason string
+	}{
+		{"valid", v.CheckExpiry(at(hour)), ""},
+		{"valid nbf", v.CheckNotBefore(at(-time.Minute)), ""},
+		{"no nbf", v.CheckNotBefore(time.Time{}), ""},
+		{"valid iat", v.CheckIssuedAt(at(-time.Minute)), ""},
+		{"expired within leeway", v.CheckExpiry(at(-time.Second * 20)), ""},
+		{"iat in the future within leeway", v.CheckIssuedAt(at(time.Second * 20)), ""},
+		{"nbf in the future within leeway", v.CheckNotBefore(at(time.Second * 20)), ""},
+		{"expired", v.CheckExpiry(at(-time.Second * 40)), ReasonExpired},
+		{"iat in the future", v.CheckIssuedAt(at(time.Second * 40)), ReasonIssuedAt},
+		{"nbf in the future", v.CheckNotBefore(at(time.Second * 40)), ReasonNotBefore},
+	} {
+		if len(c.reason) < 1 {
+			assert.NoError(t, c.err, c.name)
+			continue
+		}
+		if assert.Error(t, c.err, c.name) {
+			assert.Equal(t, c.reason, ErrorReason(c.err), c.name)
+		}
+	}
+
+	// auth_time against max_age
+	for _, c := range []struct {
+		name     string
+		authTime time.Time
+		maxAge   time.Duration
+		reason   string
+	}{
+		{"recent", at(-time.Minute), time.Minute * 5, ""},
+		{"older within leeway", at(-time.Minute*5 - time.Second*20), time.Minute * 5, ""},
+		{"older", at(-time.Minute*5 - time.Second*40), time.Minute * 5, ReasonAuthTime},
+		{"future", at(time.Minute), time.Minute * 5, ReasonAuthTime},
+		{"not found", time.Time{}, time.Minute * 5, ReasonAuthTime},
+	} {
+		err := v.ValidateAuthTime(c.authTime, c.maxAge)
+		if len(c.reason) < 1 {
+			assert.NoError(t, err, c.name)
+			continue
+		}
+		if assert.Error(t, err, c.name) {
+			assert.Equal(t, c.reason, ErrorReason(err), c.name)
+		}
+	}
+
+	// typed error has the values
+	err := v.CheckExpiry(at(-time.Minute))
+	te, ok := err.(*TimeError)
+	if assert.True(t, ok) {
+		assert.Equal(t, "exp", te.Claim)
+		assert.Equal(t, time.Second*30, te.Leeway)
+		assert.Equal(t, "Expired 1m0s ago at 2020-09-13T12:25:40Z", te.Error())
+	}
+
+	assert.True(t, v.Expired(at(-time.Minute)))
+	assert.False(t, v.Expired(at(-time.Second*10)))
+	assert.Equal(t, time.Duration(0), NewTimeValidator(0).Leeway)
+
+	// unset leeway of config is DefaultLeeway
+	zero := time.Duration(0)
+	assert.Equal(t, DefaultLeeway, (&Config{}).ClockLeeway())
+	assert.Equal(t, zero, (&Config{Leeway: &zero}).ClockLeeway())
+}
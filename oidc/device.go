@@ -0,0 +1,156 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// DeviceGrantType is grant_type of device access token request
+const DeviceGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// Error codes of device access token response. RFC 8628 3.5
+const (
+	ErrAuthorizationPending = "authorization_pending"
+	ErrSlowDown             = "slow_down"
+	ErrAccessDenied         = "access_denied"
+	ErrExpiredToken         = "expired_token"
+)
+
+// defaultInterval is polling interval when the provider does not specify
+const defaultInterval = 5
+
+// pollUnit is unit of interval and expires_in. Tests shorten it.
+var pollUnit = time.Second
+
+// DeviceAuthorization is response of device authorization endpoint. RFC 8628 3.2
+type DeviceAuthorization struct {
+	DeviceCode              string `json:"device_code"`
+	UserCode                string `json:"user_code"`
+	VerificationURI         string `json:"verification_uri"`
+	VerificationURIComplete string `json:"verification_uri_complete,omitempty"`
+	ExpiresIn               int    `json:"expires_in"`
+	Interval                int    `json:"interval,omitempty"`
+}
+
+// TokenSet is response of token endpoint with verified claims of ID token
+type TokenSet struct {
+	TokenResponse
+	Claims map[string]interface{}
+}
+
+// Expiry returns exp of ID token
+func (t *TokenSet) Expiry() time.Time {
+	if n, ok := t.Claims["exp"].(json.Number); ok {
+		if sec, err := n.Int64(); err == nil {
+			return time.Unix(sec, 0)
+		}
+	}
+	return time.Time{}
+}
+
+// RequestDeviceCode requests device code and user code. RFC 8628 3.1
+func RequestDeviceCode(ctx context.Context, hc *http.Client, c *Config) (*DeviceAuthorization, error) {
+	if len(c.Endpoint.DeviceAuthURL) < 1 {
+		return nil, errors.Errorf("device_auth_url is empty")
+	}
+	scopes := c.Scopes
+	if len(scopes) < 1 {
+		scopes = []string{"openid"}
+	}
+	form := url.Values{"scope": {strings.Join(scopes, " ")}}
+	var da DeviceAuthorization
+	if err := postForm(ctx, hc, c, c.Endpoint.DeviceAuthURL, form, &da); err != nil {
+		return nil, err
+	}
+	if len(da.DeviceCode) < 1 || len(da.UserCode) < 1 || len(da.VerificationURI) < 1 {
+		return nil, errors.Errorf("Invalid device authorization response")
+	}
+	return &da, nil
+}
+
+// PollDeviceToken polls token endpoint until the user approves on another device.
+// It waits interval between requests and increases it by 5 seconds on slow_down.
+// RFC 8628 3.4, 3.5
+func PollDeviceToken(ctx context.Context, hc *http.Client, c *Config, da *DeviceAuthorization) (*TokenResponse, error) {
+	interval := time.Duration(da.Interval) * pollUnit
+	if da.Interval < 1 {
+		interval = defaultInterval * pollUnit
+	}
+	var deadline time.Time
+	if da.ExpiresIn > 0 {
+		deadline = time.Now().Add(time.Duration(da.ExpiresIn) * pollUnit)
+	}
+	form := url.Values{
+		"grant_type":  {DeviceGrantType},
+		"device_code": {da.DeviceCode},
+	}
+	t := time.NewTimer(interval)
+	defer t.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, errors.WithStack(ctx.Err())
+		case <-t.C:
+		}
+		if !deadline.IsZero() && time.Now().After(deadline) {
+			return nil, &TokenError{Code: ErrExpiredToken, Description: "device code is expired"}
+		}
+		tr, err := requestToken(ctx, hc, c, form)
+		if te, ok := err.(*TokenError); ok {
+			switch te.Code {
+			case ErrAuthorizationPending:
+			case ErrSlowDown:
+				interval += defaultInterval * pollUnit
+			default:
+				return nil, te
+			}
+			t.Reset(interval)
+			continue
+		}
+		return tr, err
+	}
+}
+
+// DeviceLogin runs device authorization grant and verifies ID token by kf.
+// prompt shows verification URI and user code to the user. default prints them to stderr.
+func DeviceLogin(ctx context.Context, hc *http.Client, c *Config, kf jwt.Keyfunc, prompt func(*DeviceAuthorization)) (*TokenSet, error) {
+	da, err := RequestDeviceCode(ctx, hc, c)
+	if err != nil {
+		return nil, err
+	}
+	if prompt == nil {
+		prompt = func(da *DeviceAuthorization) { PrintDeviceCode(os.Stderr, da) }
+	}
+	prompt(da)
+	tr, err := PollDeviceToken(ctx, hc, c, da)
+	if err != nil {
+		return nil, err
+	}
+	if len(tr.IDToken) < 1 {
+		return nil, errors.Errorf("Not found id_token. Request openid scope")
+	}
+	claims, err := VerifyIDToken(tr.IDToken, kf, c)
+	if err != nil {
+		return nil, err
+	}
+	return &TokenSet{TokenResponse: *tr, Claims: claims.Map()}, nil
+}
+
+// PrintDeviceCode shows where to enter user code
+func PrintDeviceCode(w io.Writer, da *DeviceAuthorization) {
+	fmt.Fprintf(w, "Open %s on another device and enter the code:\n\n  %s\n\n", da.VerificationURI, da.UserCode)
+	if len(da.VerificationURIComplete) > 0 {
+		fmt.Fprintf(w, "or open %s\n\n", da.VerificationURIComplete)
+	}
+	fmt.Fprintln(w, "Waiting for approval...")
+}
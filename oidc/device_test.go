@@ -0,0 +1,100 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDeviceFlow(t *testing.T) {
+	defer func(u time.Duration) { pollUnit = u }(pollUnit)
+	pollUnit = time.Millisecond * 10
+
+	// responses of token endpoint in order
+	var responses []string
+	var polls []time.Time
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		w.Header().Set("Content-Type", "application/json")
+		switch r.URL.Path {
+		case "/device":
+			assert.Equal(t, "cli", r.PostForm.Get("client_id"))
+			assert.Equal(t, "openid", r.PostForm.Get("scope"))
+			json.NewEncoder(w).Encode(DeviceAuthorization{
+				DeviceCode:      "GmRhmhcxhwAzkoEqiMEg_DnyEysNkuNhszIySk9eS",
+				UserCode:        "WDJB-MJHT",
+				VerificationURI: "https://example.com/device",
+				ExpiresIn:       100,
+				Interval:        1,
+			})
+		case "/token":
+			assert.Equal(t, DeviceGrantType, r.PostForm.Get("grant_type"))
+			assert.Equal(t, "GmRhmhcxhwAzkoEqiMEg_DnyEysNkuNhszIySk9eS", r.PostForm.Get("device_code"))
+			polls = append(polls, time.Now())
+			code := responses[0]
+			responses = responses[1:]
+			if len(code) > 0 {
+				w.WriteHeader(400)
+				json.NewEncoder(w).Encode(TokenError{Code: code})
+				return
+			}
+			json.NewEncoder(w).Encode(TokenResponse{IDToken: "x.y.z", TokenType: "Bearer"})
+		}
+	}))
+	defer ts.Close()
+	c := &Config{ClientID: "cli", Endpoint: Endpoint{TokenURL: ts.URL + "/token", DeviceAuthURL: ts.URL + "/device"}}
+	ctx := context.Background()
+
+	da, err := RequestDeviceCode(ctx, nil, c)
+	checkError(t, err)
+	assert.Equal(t, "WDJB-MJHT", da.UserCode)
+
+	// pending, slow down and approved
+	responses = []string{ErrAuthorizationPending, ErrSlowDown, ErrAuthorizationPending, ""}
+	start := time.Now()
+	tr, err := PollDeviceToken(ctx, nil, c, da)
+	checkError(t, err)
+	assert.Equal(t, "x.y.z", tr.IDToken)
+	if assert.Len(t, polls, 4) {
+		assert.True(t, polls[0].Sub(start) >= pollUnit)
+		assert.True(t, polls[1].Sub(polls[0]) >= pollUnit)
+		// interval is increased by 5 after slow_down
+		assert.True(t, polls[2].Sub(polls[1]) >= pollUnit*6)
+		assert.True(t, polls[3].Sub(polls[2]) >= pollUnit*6)
+	}
+
+	// errors stop polling
+	for _, code := range []string{ErrAccessDenied, ErrExpiredToken} {
+		responses = []string{ErrAuthorizationPending, code}
+		_, err = PollDeviceToken(ctx, nil, c, da)
+		te, ok := err.(*TokenError)
+		if assert.True(t, ok, "%v", err) {
+			assert.Equal(t, code, te.Code)
+		}
+	}
+
+	// device code expires before approval
+	responses = []string{ErrAuthorizationPending, ErrAuthorizationPending, ErrAuthorizationPending}
+	_, err = PollDeviceToken(ctx, nil, c, &DeviceAuthorization{DeviceCode: da.DeviceCode, ExpiresIn: 2, Interval: 1})
+	te, ok := err.(*TokenError)
+	if assert.True(t, ok, "%v", err) {
+		assert.Equal(t, ErrExpiredToken, te.Code)
+	}
+
+	// nil prompt prints the code instead of panic. "x.y.z" is not a valid ID token
+	responses = []string{""}
+	_, err = DeviceLogin(ctx, nil, c, nil, nil)
+	assert.Error(t, err)
+
+	// canceled
+	responses = []string{ErrAuthorizationPending, ErrAuthorizationPending, ErrAuthorizationPending}
+	ctx, cancel := context.WithTimeout(ctx, pollUnit*3/2)
+	defer cancel()
+	_, err = PollDeviceToken(ctx, nil, c, da)
+	assert.Error(t, err)
+}
@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// Reason of authentication failure.
+// These are used as label of metrics so do not change the values.
+const (
+	ReasonRequest      = "request"       // malformed authentication response
+	ReasonProvider     = "provider"      // error response from provider
+	ReasonState        = "state"         // state is not matched
+	ReasonNonce        = "nonce"         // nonce is unknown or already used
+	ReasonAudience     = "audience"      // audience is not accepted
+	ReasonAZP          = "azp"           // azp is missing or not the client
+	ReasonIssuer       = "issuer"        // issuer is not accepted
+	ReasonSignature    = "signature"     // signature or kid is invalid
+	ReasonToken        = "token"         // token is malformed or claims are invalid
+	ReasonUserInfo     = "userinfo"      // sub of userinfo is not matched
+	ReasonAuthTime     = "auth_time"     // auth_time does not satisfy max_age
+	ReasonExpired      = "expired"       // exp is past
+	ReasonNotBefore    = "not_before"    // nbf is future
+	ReasonIssuedAt     = "issued_at"     // iat is future
+	ReasonACR          = "acr"           // acr is not accepted
+	ReasonTenant       = "tenant"        // tenant is not accepted
+	ReasonClaim        = "claim"         // required claim is not found
+	ReasonSessionLimit = "session_limit" // too many sessions of the user
+	ReasonUnknown      = "unknown"
+)
+
+// AuthError is authentication error with reason
+type AuthError struct {
+	Reason  string
+	Message string
+}
+
+func (e *AuthError) Error() string {
+	return e.Message
+}
+
+func authErrorf(reason, format string, args ...interface{}) error {
+	return &AuthError{Reason: reason, Message: fmt.Sprintf(format, args...)}
+}
+
+// TimeError is temporal claim out of range over the leeway
+type TimeError struct {
+	Claim  string        // exp, nbf, iat or auth_time
+	Time   time.Time     // value of the claim
+	Now    time.Time     // time of the validation
+	Leeway time.Duration // allowed clock difference
+	MaxAge time.Duration // max_age of auth_time
+}
+
+// Reason returns reason of the claim
+func (e *TimeError) Reason() string {
+	switch e.Claim {
+	case "exp":
+		return ReasonExpired
+	case "nbf":
+		return ReasonNotBefore
+	case "iat":
+		return ReasonIssuedAt
+	}
+	return ReasonAuthTime
+}
+
+func (e *TimeError) Error() string {
+	at := e.Time.UTC().Format(time.RFC3339)
+	switch e.Claim {
+	case "exp":
+		return fmt.Sprintf("Expired %s ago at %s", e.Now.Sub(e.Time).Round(time.Second), at)
+	case "nbf":
+		return fmt.Sprintf("Not valid for %s until %s", e.Time.Sub(e.Now).Round(time.Second), at)
+	case "iat":
+		return fmt.Sprintf("Issued %s in the future at %s. Check clock of the host", e.Time.Sub(e.Now).Round(time.Second), at)
+	}
+	if e.Time.After(e.Now) {
+		return fmt.Sprintf("auth_time is %s in the future at %s", e.Time.Sub(e.Now).Round(time.Second), at)
+	}
+	return fmt.Sprintf("auth_time is older than max_age %s at %s", e.MaxAge, at)
+}
+
+// ErrorReason returns reason of authentication error
+func ErrorReason(err error) string {
+	switch e := errors.Cause(err).(type) {
+	case *AuthError:
+		return e.Reason
+	case *TimeError:
+		return e.Reason()
+	case *jwt.ValidationError:
+		if e.Errors&(jwt.ValidationErrorSignatureInvalid|jwt.ValidationErrorUnverifiable) != 0 {
+			return ReasonSignature
+		}
+		return ReasonToken
+	}
+	return ReasonUnknown
+}
@@ -0,0 +1,170 @@
+package oidc
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+// Status of Check
+const (
+	CheckOK   = "ok"
+	CheckFail = "fail"
+	CheckSkip = "skip"
+)
+
+// Check is result of a verification of ID token
+type Check struct {
+	Name    string `json:"name"`
+	Status  string `json:"status"`
+	Message string `json:"message,omitempty"`
+}
+
+// Inspection is decoded ID token and results of the checks
+type Inspection struct {
+	Header map[string]interface{} `json:"header"`
+	Claims map[string]interface{} `json:"claims"`
+	Checks []Check                `json:"checks"`
+}
+
+// Valid reports no check failed
+func (i *Inspection) Valid() bool {
+	for _, v := range i.Checks {
+		if v.Status == CheckFail {
+			return false
+		}
+	}
+	return true
+}
+
+// InspectOptions are conditions of InspectIDToken
+type InspectOptions struct {
+	// Now is time to check expiry. default is time.Now()
+	Now time.Time
+	// Skew is allowed clock difference. default is Config.Leeway
+	Skew *time.Duration
+}
+
+// InspectIDToken decodes token and runs the signature check and each step of IDTokenValidator.
+// nonce is not checked because it is not a response of AuthURL.
+// It continues after failure so that all problems are shown.
+func InspectIDToken(token string, kf jwt.Keyfunc, c *Config, o InspectOptions) *Inspection {
+	if o.Now.IsZero() {
+		o.Now = time.Now()
+	}
+	in := &Inspection{}
+	add := func(name, status, format string, args ...interface{}) {
+		in.Checks = append(in.Checks, Check{Name: name, Status: status, Message: fmt.Sprintf(format, args...)})
+	}
+	skip := func(names ...string) {
+		for _, v := range names {
+			add(v, CheckSkip, "")
+		}
+	}
+
+	// the pipeline of IDTokenValidator reported step by step
+	v := newConfigValidator(c, nil)
+	v.tv.Now = func() time.Time { return o.Now }
+	if o.Skew != nil {
+		v.tv.Leeway = *o.Skew
+	}
+	steps := v.steps()
+	skipSteps := func() {
+		for _, step := range steps {
+			skip(step.name)
+		}
+	}
+
+	// format
+	parts := strings.Split(strings.TrimSpace(token), ".")
+	if len(parts) != 3 {
+		add("format", CheckFail, "token contains %d segments. JWS requires 3", len(parts))
+		skip("key", "signature", "claims")
+		skipSteps()
+		return in
+	}
+	if err := decodeSegment(parts[0], &in.Header); err != nil {
+		add("format", CheckFail, "header: %s", err)
+		skip("key", "signature", "claims")
+		skipSteps()
+		return in
+	}
+	if err := decodeSegment(parts[1], &in.Claims); err != nil {
+		add("format", CheckFail, "claims: %s", err)
+		skip("key", "signature", "claims")
+		skipSteps()
+		return in
+	}
+	add("format", CheckOK, "")
+
+	// key and signature
+	method := jwt.GetSigningMethod(fmt.Sprint(in.Header["alg"]))
+	if method == nil {
+		add("key", CheckFail, "Unknown algorithm [%v]", in.Header["alg"])
+		skip("signature")
+	} else if kf == nil {
+		add("key", CheckFail, "JWKS is not loaded")
+		skip("signature")
+	} else if key, err := kf(&jwt.Token{Header: in.Header, Method: method}); err != nil {
+		add("key", CheckFail, "%s", err)
+		skip("signature")
+	} else {
+		add("key", CheckOK, "kid=%v", in.Header["kid"])
+		if err := method.Verify(parts[0]+"."+parts[1], parts[2], key); err != nil {
+			add("signature", CheckFail, "%s", err)
+		} else {
+			add("signature", CheckOK, "%s", method.Alg())
+		}
+	}
+
+	// claims and the steps
+	var claims IDTokenClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		add("claims", CheckFail, "%s", err)
+		skipSteps()
+		return in
+	}
+	add("claims", CheckOK, "")
+	for _, step := range steps {
+		if err := step.check(&claims); err != nil {
+			add(step.name, CheckFail, "%s", err)
+			continue
+		}
+		switch step.name {
+		case "audience":
+			add(step.name, CheckOK, "%s", strings.Join(claims.Audience, ","))
+		case "issuer":
+			add(step.name, CheckOK, "%s", claims.Issuer)
+		case "exp":
+			if d := o.Now.Sub(claims.Expire()); d > 0 {
+				add(step.name, CheckOK, "Expired %s ago within skew %s", d.Round(time.Second), v.tv.Leeway)
+			} else {
+				add(step.name, CheckOK, "expires in %s", (-d).Round(time.Second))
+			}
+		case "nbf":
+			if claims.NotBeforeInt < 1 {
+				skip(step.name)
+			} else {
+				add(step.name, CheckOK, "")
+			}
+		default:
+			add(step.name, CheckOK, "")
+		}
+	}
+	return in
+}
+
+// decodeSegment decodes base64url JSON of JWS
+func decodeSegment(seg string, v interface{}) error {
+	b, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(seg, "="))
+	if err != nil {
+		return err
+	}
+	d := json.NewDecoder(strings.NewReader(string(b)))
+	d.UseNumber()
+	return d.Decode(v)
+}
@@ -0,0 +1,101 @@
+package oidc
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInspectIDToken(t *testing.T) {
+	b, err := ioutil.ReadFile("./testdata/jwk.json")
+	checkError(t, errors.WithStack(err))
+	kf, err := ParseJWK(b)
+	checkError(t, err)
+	b, err = ioutil.ReadFile("./testdata/idtoken_sample.txt")
+	checkError(t, errors.WithStack(err))
+	token := strings.TrimSpace(string(b))
+	c := &Config{ClientID: "s6BhdRkqt3", Issuers: []string{"http://server.example.com"}}
+
+	status := func(in *Inspection) map[string]string {
+		m := make(map[string]string)
+		for _, v := range in.Checks {
+			m[v.Name] = v.Status
+		}
+		return m
+	}
+
+	// sample token is valid between iat and exp
+	in := InspectIDToken(token, kf, c, InspectOptions{Now: time.Unix(1311281000, 0)})
+	assert.True(t, in.Valid(), "%+v", in.Checks)
+	assert.Equal(t, "RS256", in.Header["alg"])
+	assert.Equal(t, "248289761001", in.Claims["sub"])
+
+	// every failed check is reported
+	c = &Config{ClientID: "other", Issuers: []string{"https://issuer.example.com"}}
+	in = InspectIDToken(token, kf, c, InspectOptions{})
+	assert.False(t, in.Valid())
+	assert.Equal(t, map[string]string{
+		"format":    CheckOK,
+		"key":       CheckOK,
+		"signature": CheckOK,
+		"claims":    CheckOK,
+		"audience":  CheckFail,
+		"issuer":    CheckFail,
+		"exp":       CheckFail,
+		"iat":       CheckOK,
+		"nbf":       CheckSkip,
+	}, status(in))
+
+	// skew allows clock difference
+	skew := time.Second * 30
+	in = InspectIDToken(token, kf, &Config{ClientID: "s6BhdRkqt3"}, InspectOptions{
+		Now:  time.Unix(1311281970+20, 0),
+		Skew: &skew,
+	})
+	assert.True(t, in.Valid(), "%+v", in.Checks)
+	// zero skew and zero leeway are strict
+	zero := time.Duration(0)
+	in = InspectIDToken(token, kf, &Config{ClientID: "s6BhdRkqt3"}, InspectOptions{
+		Now:  time.Unix(1311281970+20, 0),
+		Skew: &zero,
+	})
+	assert.Equal(t, CheckFail, status(in)["exp"])
+	in = InspectIDToken(token, kf, &Config{ClientID: "s6BhdRkqt3", Leeway: &zero}, InspectOptions{
+		Now: time.Unix(1311281970+20, 0),
+	})
+	assert.Equal(t, CheckFail, status(in)["exp"])
+	in = InspectIDToken(token, kf, &Config{ClientID: "s6BhdRkqt3"}, InspectOptions{
+		Now: time.Unix(1311280970-60, 0),
+	})
+	assert.Equal(t, CheckFail, status(in)["iat"])
+
+	// additional checks of the config
+	c = &Config{ClientID: "s6BhdRkqt3", Checks: ClaimChecks{ACRValues: []string{"mfa"}}}
+	in = InspectIDToken(token, kf, c, InspectOptions{Now: time.Unix(1311281000, 0)})
+	assert.Equal(t, CheckFail, status(in)["checks"])
+	assert.Contains(t, in.Checks[len(in.Checks)-1].Message, "Unacceptable acr")
+
+	// tampered claims
+	parts := strings.Split(token, ".")
+	in = InspectIDToken(parts[0]+"."+parts[0]+"."+parts[2], kf, c, InspectOptions{})
+	assert.Equal(t, CheckFail, status(in)["signature"])
+
+	// unknown kid
+	kf, err = ParseJWK([]byte(`{"keys":[]}`))
+	checkError(t, err)
+	in = InspectIDToken(token, kf, c, InspectOptions{})
+	assert.Equal(t, CheckFail, status(in)["key"])
+	assert.Equal(t, CheckSkip, status(in)["signature"])
+	assert.Contains(t, in.Checks[1].Message, "Unknown kid: 1e9gdk7")
+
+	// not a JWT
+	in = InspectIDToken("abc", kf, c, InspectOptions{})
+	assert.Equal(t, CheckFail, status(in)["format"])
+	// every step of the validator is reported as skipped
+	assert.Equal(t, CheckSkip, status(in)["checks"])
+	assert.Len(t, in.Checks, 10)
+}
@@ -4,6 +4,8 @@ import (
 	"net/http"
 	"net/url"
 	"time"
+
+	"github.com/uzuna/go-authproxy/secret"
 )
 
 const (
@@ -33,20 +35,46 @@ type Authenticator interface {
 	// Validate(req *http.Request) (Token, error)
 }
 
+// ClientSecretSetter replaces client_secret of Authenticator e.g. rotated secret on reload
+type ClientSecretSetter interface {
+	SetClientSecret(v secret.Value)
+}
+
 type Config struct {
-	ClientID     string   `json:"client_id" yaml:"client_id"`
-	ClientSecret string   `json:"client_secret" yaml:"client_secret"`
-	Endpoint     Endpoint `json:"endpoint" yaml:"endpoint"`
-	RedirectURL  string   `json:"redirect_url" yaml:"redirect_url"`
-	JWKURL       string   `json:"jwk_url" yaml:"jwk_url"`
-	Scopes       []string `json:"scopes" yaml:"scopes"`
-	ResponseType string   `json:"response_type" yaml:"response_type"`
-	Issuers      []string `json:"issuers" yaml:"issuers"`
+	ClientID     string       `json:"client_id" yaml:"client_id"`
+	ClientSecret secret.Value `json:"client_secret" yaml:"client_secret"`
+	Endpoint     Endpoint     `json:"endpoint" yaml:"endpoint"`
+	RedirectURL  string       `json:"redirect_url" yaml:"redirect_url"`
+	JWKURL       string       `json:"jwk_url" yaml:"jwk_url"`
+	Scopes       []string     `json:"scopes" yaml:"scopes"`
+	ResponseType string       `json:"response_type" yaml:"response_type"`
+	Issuers      []string     `json:"issuers" yaml:"issuers"`
+	// ClientIDs are audiences accepted in addition to ClientID.
+	// e.g. tokens of CLI client presented as bearer token
+	ClientIDs []string `json:"client_ids,omitempty" yaml:"client_ids,omitempty"`
+	// Checks are additional checks of ID token
+	Checks ClaimChecks `json:"checks,omitempty" yaml:"checks,omitempty"`
+	// UserInfoURL is userinfo_endpoint. It requires access token in
+	// authentication response e.g. response_type "id_token token"
+	UserInfoURL string `json:"userinfo_url" yaml:"userinfo_url"`
+	// Leeway is allowed clock difference of exp, nbf, iat and auth_time.
+	// nil is DefaultLeeway and zero means strict check
+	Leeway *time.Duration `json:"leeway,omitempty" yaml:"leeway,omitempty"`
+}
+
+// ClockLeeway returns Leeway or DefaultLeeway when it is not set
+func (c *Config) ClockLeeway() time.Duration {
+	if c.Leeway == nil {
+		return DefaultLeeway
+	}
+	return *c.Leeway
 }
 
 type Endpoint struct {
 	AuthURL  string `json:"auth_url" yaml:"auth_url"`
 	TokenURL string `json:"token_url" yaml:"token_url"`
+	// DeviceAuthURL is device_authorization_endpoint of RFC 8628
+	DeviceAuthURL string `json:"device_auth_url,omitempty" yaml:"device_auth_url,omitempty"`
 }
 
 // URLOptionalParameter godoc
@@ -62,3 +90,12 @@ func (p setParam) setValue(m url.Values) { m.Set(p.k, p.v) }
 func SetURLParam(key, value string) URLOptionalParameter {
 	return setParam{key, value}
 }
+
+// URLParams returns values of the parameters for other Authenticator implementations
+func URLParams(opts ...URLOptionalParameter) url.Values {
+	v := url.Values{}
+	for _, x := range opts {
+		x.setValue(v)
+	}
+	return v
+}
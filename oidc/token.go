@@ -1,28 +1,130 @@
 package oidc
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/lestrrat-go/jwx/jwk"
-	"github.com/uzuna/go-authproxy/internal/nonce"
 
 	"github.com/pkg/errors"
 )
 
 // IDToken standard parameters
 type IDTokenClaims struct {
-	Issuer      string `json:"iss"`
-	Subject     string `json:"sub"`
-	Audience    string `json:"aud"`
-	Nonce       string `json:"nonce"`
-	ExpireInt   int64  `json:"exp"`
-	IssuedAtInt int64  `json:"iat"`
-	AuthTime    int64  `json:"auth_time"`
-	ACR         string `json:"acr"`
-	AMR         string `json:"amr"`
-	AZP         string `json:"azp"`
+	Issuer       string   `json:"iss"`
+	Subject      string   `json:"sub"`
+	Audience     Audience `json:"aud"`
+	Nonce        string   `json:"nonce"`
+	ExpireInt    int64    `json:"exp"`
+	IssuedAtInt  int64    `json:"iat"`
+	NotBeforeInt int64    `json:"nbf,omitempty"`
+	AuthTime     int64    `json:"auth_time"`
+	ACR          string   `json:"acr"`
+	AMR          []string `json:"amr,omitempty"`
+	AZP          string   `json:"azp,omitempty"`
+
+	// all claims of the token include non-standard ones
+	raw map[string]interface{}
+}
+
+// UnmarshalJSON decodes standard claims and keeps all claims for Map and Claim
+func (c *IDTokenClaims) UnmarshalJSON(b []byte) error {
+	type plain IDTokenClaims
+	var p plain
+	if err := json.Unmarshal(b, &p); err != nil {
+		return errors.WithStack(err)
+	}
+	raw, err := decodeClaims(b)
+	if err != nil {
+		return err
+	}
+	*c = IDTokenClaims(p)
+	c.raw = raw
+	return nil
+}
+
+// Map returns all claims. Numbers are json.Number.
+func (c *IDTokenClaims) Map() map[string]interface{} {
+	raw := c.raw
+	if raw == nil {
+		// made by struct literal. decode from standard claims
+		b, err := json.Marshal(c)
+		if err != nil {
+			return map[string]interface{}{}
+		}
+		if raw, err = decodeClaims(b); err != nil {
+			return map[string]interface{}{}
+		}
+	}
+	m := make(map[string]interface{}, len(raw))
+	for k, v := range raw {
+		m[k] = v
+	}
+	return m
+}
+
+// Claim returns a claim by name include non-standard ones
+func (c *IDTokenClaims) Claim(name string) (interface{}, bool) {
+	v, ok := c.Map()[name]
+	return v, ok
+}
+
+// ValidAudience checks one of the clients is an audience and authorized party.
+// openid-connect-core-1.0 3.1.3.7
+func (c *IDTokenClaims) ValidAudience(clientIDs ...string) error {
+	return validateAudience(c.Audience, c.AZP, clientIDs...)
+}
+
+func decodeClaims(b []byte) (map[string]interface{}, error) {
+	var m map[string]interface{}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	if err := dec.Decode(&m); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return m, nil
+}
+
+// Audience is aud claim which is a string or an array of strings. RFC 7519 4.1.3
+type Audience []string
+
+// UnmarshalJSON accepts both of a string and an array
+func (a *Audience) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		*a = nil
+		if len(s) > 0 {
+			*a = Audience{s}
+		}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(b, &list); err != nil {
+		return errors.Errorf("aud must be a string or an array of strings")
+	}
+	*a = list
+	return nil
+}
+
+// MarshalJSON encodes single audience as a string
+func (a Audience) MarshalJSON() ([]byte, error) {
+	if len(a) == 1 {
+		return json.Marshal(a[0])
+	}
+	return json.Marshal([]string(a))
+}
+
+// Contains reports the audience has the client id
+func (a Audience) Contains(clientID string) bool {
+	for _, v := range a {
+		if v == clientID {
+			return true
+		}
+	}
+	return false
 }
 
 // Valid is check field and format specification
@@ -73,11 +175,11 @@ func MakeKeyfunc(jwkset *jwk.Set) (jwt.Keyfunc, error) {
 	return func(token *jwt.Token) (interface{}, error) {
 		if _, ok := token.Method.(*jwt.SigningMethodRSA); ok {
 			// Check kid
-			kid, ok := token.Header["kid"]
+			kid, ok := token.Header["kid"].(string)
 			if !ok {
 				return nil, fmt.Errorf("Has not kid property")
 			}
-			key := jwkset.LookupKeyID(kid.(string))
+			key := jwkset.LookupKeyID(kid)
 			if len(key) < 1 {
 				return nil, fmt.Errorf("Unknown kid: %s", kid)
 			}
@@ -98,48 +200,3 @@ func ParseIDToken(token string, kf jwt.Keyfunc) (*IDTokenClaims, error) {
 	}
 	return &claims, nil
 }
-
-func NewIDTokenValidator(issuers, clientids []string, ns nonce.Store) (*IDTokenValidator, error) {
-	issmap := make(map[string]struct{}, len(issuers))
-	climap := make(map[string]struct{}, len(clientids))
-	for _, v := range issuers {
-		issmap[v] = struct{}{}
-	}
-	for _, v := range clientids {
-		climap[v] = struct{}{}
-	}
-	return &IDTokenValidator{
-		ns:     ns,
-		issmap: issmap,
-		climap: climap,
-	}, nil
-}
-
-// IDTokenValidator
-type IDTokenValidator struct {
-	ns     nonce.Store
-	issmap map[string]struct{}
-	climap map[string]struct{}
-}
-
-func (t *IDTokenValidator) Validate(claims *IDTokenClaims) error {
-	// Check Nonce
-	if ok := t.ns.CheckOnce(claims.Nonce); !ok {
-		return errors.Errorf("Invalid nonce")
-	}
-	// Check Audience
-	if _, ok := t.climap[claims.Audience]; !ok {
-		return errors.Errorf("Un match ClientID(Audience)")
-	}
-	// Check Issuer
-	if _, ok := t.issmap[claims.Issuer]; !ok {
-		return errors.Errorf("Un match Issuer")
-	}
-
-	sub := time.Since(claims.Expire())
-	if sub >= time.Duration(0) {
-		return errors.Errorf("Expired %s", sub.String())
-	}
-
-	return nil
-}
@@ -1,6 +1,7 @@
 package oidc_test
 
 import (
+	"encoding/json"
 	"io/ioutil"
 	"strings"
 	"testing"
@@ -28,19 +29,51 @@ func TestIDToken(t *testing.T) {
 
 	claims, err := oidc.ParseIDToken(idTokenStr, f)
 	checkError(t, errors.WithStack(err))
-	assert.Equal(t, "s6BhdRkqt3", claims.Audience)
+	assert.Equal(t, oidc.Audience{"s6BhdRkqt3"}, claims.Audience)
 	assert.True(t, claims.Expire().Equal(time.Unix(1311281970, 0)), "Un match ExpireAt")
 	assert.True(t, claims.IssuedAt().Equal(time.Unix(1311280970, 0)), "Un match IssuedAt")
 
 	// ns := nonce.NewStore(time.Second * 10)
 	ns := &DummyNonceStore{}
-	vr, err := oidc.NewIDTokenValidator([]string{claims.Issuer}, []string{claims.Audience}, ns)
-	checkError(t, errors.WithStack(err))
+	vr := oidc.NewIDTokenValidator([]string{claims.Issuer}, claims.Audience, ns)
 	err = vr.Validate(claims)
 	// test tokenは期限切れしているがそれ以外は正しいと返す
 	assert.True(t, strings.Contains(err.Error(), "Expired"))
 }
 
+func TestIDTokenClaims(t *testing.T) {
+	var claims oidc.IDTokenClaims
+	err := json.Unmarshal([]byte(`{"iss":"https://idp","sub":"alice","aud":["api","client"],
+		"azp":"client","amr":["pwd","otp"],"exp":1311281970,"groups":["admin"],"tenant":"t1"}`), &claims)
+	checkError(t, errors.WithStack(err))
+	assert.Equal(t, oidc.Audience{"api", "client"}, claims.Audience)
+	assert.Equal(t, []string{"pwd", "otp"}, claims.AMR)
+	assert.NoError(t, claims.ValidAudience("client"))
+
+	// non-standard claims are kept
+	v, ok := claims.Claim("tenant")
+	assert.True(t, ok)
+	assert.Equal(t, "t1", v)
+	m := claims.Map()
+	assert.Equal(t, []interface{}{"admin"}, m["groups"])
+	assert.Equal(t, json.Number("1311281970"), m["exp"])
+
+	// single audience as string
+	err = json.Unmarshal([]byte(`{"aud":"client"}`), &claims)
+	checkError(t, errors.WithStack(err))
+	assert.Equal(t, oidc.Audience{"client"}, claims.Audience)
+	b, err := json.Marshal(claims.Audience)
+	checkError(t, errors.WithStack(err))
+	assert.Equal(t, `"client"`, string(b))
+
+	err = json.Unmarshal([]byte(`{"aud":1}`), &claims)
+	assert.Error(t, err)
+
+	// struct literal
+	claims = oidc.IDTokenClaims{Subject: "bob", Audience: oidc.Audience{"client"}}
+	assert.Equal(t, "client", claims.Map()["aud"])
+}
+
 func checkError(t *testing.T, err error) {
 	if err != nil {
 		t.Logf("%+v", err)
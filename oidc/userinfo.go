@@ -0,0 +1,62 @@
+package oidc
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"mime"
+	"net/http"
+
+	"github.com/pkg/errors"
+)
+
+// UserInfoClient fetches claims from userinfo_endpoint of the provider
+type UserInfoClient struct {
+	URL    string
+	Client *http.Client
+}
+
+// NewUserInfoClient creates UserInfoClient. It returns nil when url is empty.
+func NewUserInfoClient(url string) *UserInfoClient {
+	if len(url) < 1 {
+		return nil
+	}
+	return &UserInfoClient{URL: url, Client: http.DefaultClient}
+}
+
+// Fetch requests claims with access token.
+// openid-connect-core-1.0 5.3.2. sub of the response must match sub of ID token.
+func (c *UserInfoClient) Fetch(ctx context.Context, accessToken, sub string) (map[string]interface{}, error) {
+	if len(accessToken) < 1 {
+		return nil, errors.Errorf("Has not access token")
+	}
+	req, err := http.NewRequest("GET", c.URL, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", accessToken))
+	req.Header.Set("Accept", "application/json")
+	res, err := c.Client.Do(req.WithContext(ctx))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("Userinfo responds status %d", res.StatusCode)
+	}
+	mt, _, _ := mime.ParseMediaType(res.Header.Get("Content-Type"))
+	if mt != "application/json" {
+		return nil, errors.Errorf("Unsupported userinfo content type [%s]", mt)
+	}
+
+	var claims map[string]interface{}
+	dec := json.NewDecoder(res.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if v, _ := claims["sub"].(string); v != sub {
+		return nil, authErrorf(ReasonUserInfo, "Unmatch sub of userinfo [%s]", v)
+	}
+	return claims, nil
+}
@@ -0,0 +1,210 @@
+package oidc
+
+import (
+	"time"
+
+	"github.com/uzuna/go-authproxy/internal/nonce"
+)
+
+// ClaimCheck is additional check of verified ID token claims.
+// It returns AuthError to be counted by reason.
+type ClaimCheck func(claims *IDTokenClaims) error
+
+// ValidatorOption is optional setting of IDTokenValidator
+type ValidatorOption func(*IDTokenValidator)
+
+// WithLeeway sets allowed clock difference. default is DefaultLeeway
+func WithLeeway(d time.Duration) ValidatorOption {
+	return func(t *IDTokenValidator) {
+		t.tv = NewTimeValidator(d)
+	}
+}
+
+// WithChecks appends additional checks executed after standard ones
+func WithChecks(checks ...ClaimCheck) ValidatorOption {
+	return func(t *IDTokenValidator) {
+		t.checks = append(t.checks, checks...)
+	}
+}
+
+// NewIDTokenValidator makes validator which accepts tokens of the issuers for the client ids.
+// All issuers are accepted when issuers is empty.
+func NewIDTokenValidator(issuers, clientids []string, ns nonce.Store, opts ...ValidatorOption) *IDTokenValidator {
+	issmap := make(map[string]struct{}, len(issuers))
+	for _, v := range issuers {
+		issmap[v] = struct{}{}
+	}
+	t := &IDTokenValidator{
+		ns:        ns,
+		issmap:    issmap,
+		clientIDs: clientids,
+		tv:        NewTimeValidator(DefaultLeeway),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// newConfigValidator makes validator from provider config
+func newConfigValidator(c *Config, ns nonce.Store) *IDTokenValidator {
+	ids := append([]string{c.ClientID}, c.ClientIDs...)
+	return NewIDTokenValidator(c.Issuers, ids, ns, WithLeeway(c.ClockLeeway()), WithChecks(c.Checks.ClaimChecks()...))
+}
+
+// IDTokenValidator is validation pipeline of ID token claims.
+// It is shared by authentication response and bearer token.
+type IDTokenValidator struct {
+	ns        nonce.Store
+	issmap    map[string]struct{}
+	clientIDs []string
+	tv        *TimeValidator
+	checks    []ClaimCheck
+}
+
+// Validate checks nonce of authentication response and then ValidateToken
+func (t *IDTokenValidator) Validate(claims *IDTokenClaims) error {
+	if t.ns == nil || !t.ns.CheckOnce(claims.Nonce) {
+		return authErrorf(ReasonNonce, "Invalid nonce")
+	}
+	return t.ValidateToken(claims)
+}
+
+// ValidateToken checks audience, azp, issuer, temporal claims and additional checks.
+// nonce is not checked because bearer token is not a response of AuthURL.
+func (t *IDTokenValidator) ValidateToken(claims *IDTokenClaims) error {
+	for _, step := range t.steps() {
+		if err := step.check(claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// validationStep is a named step of ValidateToken. InspectIDToken reports each of them.
+type validationStep struct {
+	name  string
+	check ClaimCheck
+}
+
+// steps returns the pipeline of ValidateToken in order
+func (t *IDTokenValidator) steps() []validationStep {
+	steps := []validationStep{
+		{"audience", func(c *IDTokenClaims) error { return c.ValidAudience(t.clientIDs...) }},
+		{"issuer", func(c *IDTokenClaims) error {
+			if !t.acceptIssuer(c.Issuer) {
+				return authErrorf(ReasonIssuer, "Unacceptable Issuer [%s]", c.Issuer)
+			}
+			return nil
+		}},
+		{"exp", func(c *IDTokenClaims) error {
+			if c.ExpireInt < 1 {
+				return authErrorf(ReasonToken, "Not found exp")
+			}
+			return t.tv.CheckExpiry(unixTime(c.ExpireInt))
+		}},
+		{"iat", func(c *IDTokenClaims) error {
+			if c.IssuedAtInt < 1 {
+				return authErrorf(ReasonToken, "Not found iat")
+			}
+			return t.tv.CheckIssuedAt(unixTime(c.IssuedAtInt))
+		}},
+		{"nbf", func(c *IDTokenClaims) error { return t.tv.CheckNotBefore(unixTime(c.NotBeforeInt)) }},
+	}
+	if len(t.checks) > 0 {
+		steps = append(steps, validationStep{"checks", func(c *IDTokenClaims) error { return runChecks(t.checks, c) }})
+	}
+	return steps
+}
+
+// runChecks returns the first error of the checks
+func runChecks(checks []ClaimCheck, claims *IDTokenClaims) error {
+	for _, check := range checks {
+		if err := check(claims); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *IDTokenValidator) acceptIssuer(iss string) bool {
+	if len(t.issmap) < 1 {
+		return true
+	}
+	_, ok := t.issmap[iss]
+	return ok
+}
+
+// ClaimChecks is config of additional checks
+type ClaimChecks struct {
+	// ACRValues are accepted acr. any acr is accepted when empty
+	ACRValues []string `json:"acr_values,omitempty" yaml:"acr_values,omitempty"`
+	// TenantClaim is name of tenant claim. default is "tid"
+	TenantClaim string `json:"tenant_claim,omitempty" yaml:"tenant_claim,omitempty"`
+	// Tenants are accepted values of TenantClaim. any tenant is accepted when empty
+	Tenants []string `json:"tenants,omitempty" yaml:"tenants,omitempty"`
+	// RequiredClaims must be present in the token
+	RequiredClaims []string `json:"required_claims,omitempty" yaml:"required_claims,omitempty"`
+}
+
+// ClaimChecks builds checks from the config
+func (c ClaimChecks) ClaimChecks() []ClaimCheck {
+	var checks []ClaimCheck
+	if len(c.ACRValues) > 0 {
+		checks = append(checks, ACRValues(c.ACRValues...))
+	}
+	if len(c.Tenants) > 0 {
+		claim := c.TenantClaim
+		if len(claim) < 1 {
+			claim = "tid"
+		}
+		checks = append(checks, AllowTenants(claim, c.Tenants...))
+	}
+	if len(c.RequiredClaims) > 0 {
+		checks = append(checks, RequireClaims(c.RequiredClaims...))
+	}
+	return checks
+}
+
+// ACRValues accepts tokens of the acr values
+func ACRValues(values ...string) ClaimCheck {
+	return func(claims *IDTokenClaims) error {
+		if !contains(values, claims.ACR) {
+			return authErrorf(ReasonACR, "Unacceptable acr [%s]", claims.ACR)
+		}
+		return nil
+	}
+}
+
+// AllowTenants accepts tokens which string claim is one of the tenants
+func AllowTenants(claim string, tenants ...string) ClaimCheck {
+	return func(claims *IDTokenClaims) error {
+		v, _ := claims.Claim(claim)
+		s, _ := v.(string)
+		if !contains(tenants, s) {
+			return authErrorf(ReasonTenant, "Unacceptable tenant %s [%s]", claim, s)
+		}
+		return nil
+	}
+}
+
+// RequireClaims rejects tokens without the claims
+func RequireClaims(names ...string) ClaimCheck {
+	return func(claims *IDTokenClaims) error {
+		for _, name := range names {
+			if v, ok := claims.Claim(name); !ok || v == nil {
+				return authErrorf(ReasonClaim, "Not found claim [%s]", name)
+			}
+		}
+		return nil
+	}
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,104 @@
+package oidc
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIDTokenValidator(t *testing.T) {
+	now := time.Unix(1600000000, 0)
+	v := NewIDTokenValidator(
+		[]string{"https://idp.example.com", "https://sts.example.com"},
+		[]string{"web", "cli"},
+		&DummyNonceStore{},
+		WithLeeway(time.Minute),
+		WithChecks(ACRValues("mfa", "phr"), AllowTenants("tid", "t1"), RequireClaims("email")),
+	)
+	v.tv.Now = func() time.Time { return now }
+
+	// valid claims. each case modifies one of them
+	base := func() map[string]interface{} {
+		return map[string]interface{}{
+			"iss":   "https://idp.example.com",
+			"sub":   "248289761001",
+			"aud":   "web",
+			"nonce": sampleNonce,
+			"exp":   now.Add(time.Hour).Unix(),
+			"iat":   now.Unix(),
+			"acr":   "mfa",
+			"tid":   "t1",
+			"email": "jane@example.com",
+		}
+	}
+	tests := []struct {
+		name   string
+		modify func(m map[string]interface{})
+		reason string
+	}{
+		{"valid", func(m map[string]interface{}) {}, ""},
+		{"second client", func(m map[string]interface{}) { m["aud"] = "cli" }, ""},
+		{"second issuer", func(m map[string]interface{}) { m["iss"] = "https://sts.example.com" }, ""},
+		{"multiple audiences", func(m map[string]interface{}) { m["aud"] = []string{"api", "web"}; m["azp"] = "web" }, ""},
+		{"within leeway", func(m map[string]interface{}) { m["exp"] = now.Add(-30 * time.Second).Unix() }, ""},
+		{"nonce", func(m map[string]interface{}) { m["nonce"] = "replayed" }, ReasonNonce},
+		{"audience", func(m map[string]interface{}) { m["aud"] = "other" }, ReasonAudience},
+		{"azp missing", func(m map[string]interface{}) { m["aud"] = []string{"api", "web"} }, ReasonAZP},
+		{"azp other", func(m map[string]interface{}) { m["azp"] = "api" }, ReasonAZP},
+		{"issuer", func(m map[string]interface{}) { m["iss"] = "https://evil.example.com" }, ReasonIssuer},
+		{"expired", func(m map[string]interface{}) { m["exp"] = now.Add(-time.Hour).Unix() }, ReasonExpired},
+		{"not before", func(m map[string]interface{}) { m["nbf"] = now.Add(time.Hour).Unix() }, ReasonNotBefore},
+		{"exp missing", func(m map[string]interface{}) { delete(m, "exp") }, ReasonToken},
+		{"iat missing", func(m map[string]interface{}) { delete(m, "iat") }, ReasonToken},
+		{"issued at", func(m map[string]interface{}) { m["iat"] = now.Add(time.Hour).Unix() }, ReasonIssuedAt},
+		{"acr", func(m map[string]interface{}) { m["acr"] = "pwd" }, ReasonACR},
+		{"acr missing", func(m map[string]interface{}) { delete(m, "acr") }, ReasonACR},
+		{"tenant", func(m map[string]interface{}) { m["tid"] = "t2" }, ReasonTenant},
+		{"required claim", func(m map[string]interface{}) { delete(m, "email") }, ReasonClaim},
+	}
+	for _, x := range tests {
+		t.Run(x.name, func(t *testing.T) {
+			m := base()
+			x.modify(m)
+			b, err := json.Marshal(m)
+			checkError(t, err)
+			var claims IDTokenClaims
+			checkError(t, json.Unmarshal(b, &claims))
+
+			err = v.Validate(&claims)
+			if len(x.reason) < 1 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Equal(t, x.reason, ErrorReason(err), err)
+		})
+	}
+
+	// validator without nonce store accepts only tokens which are not a response of AuthURL
+	c := &Config{ClientID: "web", Issuers: []string{"https://idp.example.com"}, Checks: ClaimChecks{ACRValues: []string{"mfa"}}}
+	v = newConfigValidator(c, nil)
+	v.tv.Now = func() time.Time { return now }
+	b, err := json.Marshal(base())
+	checkError(t, err)
+	var claims IDTokenClaims
+	checkError(t, json.Unmarshal(b, &claims))
+	assert.Equal(t, ReasonNonce, ErrorReason(v.Validate(&claims)))
+	assert.NoError(t, v.ValidateToken(&claims))
+}
+
+func TestClaimChecks(t *testing.T) {
+	assert.Empty(t, ClaimChecks{}.ClaimChecks())
+
+	checks := ClaimChecks{Tenants: []string{"t1"}}.ClaimChecks()
+	assert.Len(t, checks, 1)
+	// tid is the default tenant claim
+	var claims IDTokenClaims
+	checkError(t, json.Unmarshal([]byte(`{"tid":"t1","org":"t2"}`), &claims))
+	assert.NoError(t, runChecks(checks, &claims))
+
+	checks = ClaimChecks{TenantClaim: "org", Tenants: []string{"t1"}}.ClaimChecks()
+	assert.Equal(t, ReasonTenant, ErrorReason(runChecks(checks, &claims)))
+}
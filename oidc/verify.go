@@ -0,0 +1,64 @@
+package oidc
+
+import (
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+)
+
+// TokenVerifier verifies ID token which is presented as bearer token
+type TokenVerifier interface {
+	VerifyToken(token string) (map[string]interface{}, error)
+}
+
+// VerifyToken verifies signature, expiry, audience and issuer of ID token.
+// nonce is not checked because the token is not a response of AuthURL.
+func (a *authenticator) VerifyToken(token string) (map[string]interface{}, error) {
+	claims, err := verifyIDToken(token, a.keyfunc, a.v)
+	if err != nil {
+		return nil, err
+	}
+	return claims.Map(), nil
+}
+
+// VerifyIDToken verifies ID token by the validator of the config.
+// nonce is not checked. A caller which sent nonce compares it with the claims.
+func VerifyIDToken(token string, kf jwt.Keyfunc, c *Config) (*IDTokenClaims, error) {
+	return verifyIDToken(token, kf, newConfigValidator(c, nil))
+}
+
+// verifyIDToken verifies ID token which is not a response of AuthURL
+func verifyIDToken(token string, kf jwt.Keyfunc, v *IDTokenValidator) (*IDTokenClaims, error) {
+	var claims IDTokenClaims
+	// Valid of IDTokenClaims requires nonce. claims are checked by the validator
+	p := &jwt.Parser{SkipClaimsValidation: true}
+	if _, err := p.ParseWithClaims(token, &claims, kf); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if err := v.ValidateToken(&claims); err != nil {
+		return nil, err
+	}
+	return &claims, nil
+}
+
+// validateAudience checks aud contains one of the client ids.
+// azp is required for multiple audiences and must be one of the client ids when present.
+// openid-connect-core-1.0 3.1.3.7
+func validateAudience(aud Audience, azp string, clientIDs ...string) error {
+	accepted := false
+	for _, v := range clientIDs {
+		if aud.Contains(v) {
+			accepted = true
+			break
+		}
+	}
+	if !accepted {
+		return authErrorf(ReasonAudience, "Unacceptable Audience %v", []string(aud))
+	}
+	if len(aud) > 1 && len(azp) < 1 {
+		return authErrorf(ReasonAZP, "Not found azp for multiple audiences %v", []string(aud))
+	}
+	if len(azp) > 0 && !contains(clientIDs, azp) {
+		return authErrorf(ReasonAZP, "Unacceptable azp [%s]", azp)
+	}
+	return nil
+}
@@ -0,0 +1,70 @@
+package oidc
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyToken(t *testing.T) {
+	b, err := ioutil.ReadFile("./testdata/jwk.json")
+	checkError(t, errors.WithStack(err))
+	f, err := ParseJWK(b)
+	checkError(t, err)
+	token, err := ioutil.ReadFile("./testdata/idtoken_sample.txt")
+	checkError(t, errors.WithStack(err))
+	a := newAuthenticator(&Config{ClientID: "s6BhdRkqt3"}, f, &DummyNonceStore{})
+
+	// sample token is expired
+	_, err = a.VerifyToken(strings.TrimSpace(string(token)))
+	assert.Error(t, err)
+	assert.Equal(t, ReasonExpired, ErrorReason(err))
+
+	// expired within leeway
+	a.v.tv.Now = func() time.Time { return time.Unix(1311281970+10, 0) }
+	claims, err := a.VerifyToken(strings.TrimSpace(string(token)))
+	checkError(t, err)
+	assert.Equal(t, "248289761001", claims["sub"])
+
+	// additional checks of the config are applied to bearer token
+	a = newAuthenticator(&Config{
+		ClientIDs: []string{"s6BhdRkqt3"},
+		Checks:    ClaimChecks{RequiredClaims: []string{"tid"}},
+	}, f, &DummyNonceStore{})
+	a.v.tv.Now = func() time.Time { return time.Unix(1311281970-10, 0) }
+	_, err = a.VerifyToken(strings.TrimSpace(string(token)))
+	assert.Equal(t, ReasonClaim, ErrorReason(err))
+}
+
+func TestValidateAudience(t *testing.T) {
+	tests := []struct {
+		name   string
+		aud    Audience
+		azp    string
+		reason string
+	}{
+		{"single", Audience{"s6BhdRkqt3"}, "", ""},
+		{"multiple with azp", Audience{"api", "s6BhdRkqt3"}, "s6BhdRkqt3", ""},
+		{"single with azp", Audience{"s6BhdRkqt3"}, "s6BhdRkqt3", ""},
+		{"not contained", Audience{"api"}, "", ReasonAudience},
+		{"nil", nil, "", ReasonAudience},
+		{"multiple without azp", Audience{"api", "s6BhdRkqt3"}, "", ReasonAZP},
+		{"other azp", Audience{"api", "s6BhdRkqt3"}, "api", ReasonAZP},
+		{"single with other azp", Audience{"s6BhdRkqt3"}, "api", ReasonAZP},
+	}
+	for _, v := range tests {
+		t.Run(v.name, func(t *testing.T) {
+			err := validateAudience(v.aud, v.azp, "s6BhdRkqt3")
+			if len(v.reason) < 1 {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+			assert.Equal(t, v.reason, ErrorReason(err))
+		})
+	}
+}
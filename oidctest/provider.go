@@ -0,0 +1,615 @@
+// Package oidctest runs local mock OpenID Provider for tests and development.
+// The provider logs in configured user automatically without any form.
+package oidctest
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/secret"
+)
+
+// Paths of endpoints
+const (
+	DiscoveryPath    = "/.well-known/openid-configuration"
+	AuthorizePath    = "/authorize"
+	TokenPath        = "/token"
+	JWKSPath         = "/jwks"
+	UserInfoPath     = "/userinfo"
+	EndSessionPath   = "/logout"
+	DevicePath       = "/device"
+	DeviceVerifyPath = "/device/verify" // approves user_code of the query
+)
+
+// keyID is kid of signing key
+const keyID = "oidctest"
+
+// Config is setting of mock provider
+type Config struct {
+	// Issuer is URL of the provider. NewServer sets URL of the server.
+	Issuer string
+	// ClientID is accepted client. Any client is accepted when empty.
+	ClientID string
+	// ClientSecret is required on token endpoint when not empty.
+	// Public client with PKCE does not send it.
+	ClientSecret string
+	// Claims are claims of auto login user. default sub is "oidctest-user"
+	Claims map[string]interface{}
+	// TokenLifetime is lifetime of tokens. default is 1 hour
+	TokenLifetime time.Duration
+	// DeviceInterval is polling interval of device flow in seconds. default is 5
+	DeviceInterval int
+	// Modify changes claims of ID token before signed.
+	// It is useful for negative tests such as wrong audience.
+	Modify func(claims map[string]interface{})
+}
+
+// Provider is mock OpenID Provider
+type Provider struct {
+	config Config
+	key    *rsa.PrivateKey
+	mux    *http.ServeMux
+
+	lock    *sync.Mutex
+	codes   map[string]*grant
+	devices map[string]*deviceGrant           // device code to grant
+	tokens  map[string]map[string]interface{} // access token to userinfo
+}
+
+// grant is authorization code and its request
+type grant struct {
+	clientID      string
+	redirectURI   string
+	nonce         string
+	challenge     string
+	challengeMode string
+	expireAt      time.Time
+}
+
+// deviceGrant is state of device authorization
+type deviceGrant struct {
+	clientID string
+	userCode string
+	approved bool
+	lastPoll time.Time
+	expireAt time.Time
+}
+
+// New creates Provider with new signing key
+func New(c Config) (*Provider, error) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if c.Claims == nil {
+		c.Claims = map[string]interface{}{}
+	}
+	if _, ok := c.Claims["sub"]; !ok {
+		c.Claims["sub"] = "oidctest-user"
+	}
+	if c.TokenLifetime <= 0 {
+		c.TokenLifetime = time.Hour
+	}
+	if c.DeviceInterval <= 0 {
+		c.DeviceInterval = 5
+	}
+	p := &Provider{
+		config:  c,
+		key:     key,
+		mux:     http.NewServeMux(),
+		lock:    new(sync.Mutex),
+		codes:   make(map[string]*grant),
+		devices: make(map[string]*deviceGrant),
+		tokens:  make(map[string]map[string]interface{}),
+	}
+	p.mux.HandleFunc(DiscoveryPath, p.discovery)
+	p.mux.HandleFunc(AuthorizePath, p.authorize)
+	p.mux.HandleFunc(TokenPath, p.token)
+	p.mux.HandleFunc(JWKSPath, p.jwks)
+	p.mux.HandleFunc(UserInfoPath, p.userinfo)
+	p.mux.HandleFunc(EndSessionPath, p.endSession)
+	p.mux.HandleFunc(DevicePath, p.device)
+	p.mux.HandleFunc(DeviceVerifyPath, p.deviceVerify)
+	return p, nil
+}
+
+// Server is Provider on httptest.Server
+type Server struct {
+	*httptest.Server
+	*Provider
+}
+
+// NewServer starts Provider on local port. Issuer is URL of the server.
+func NewServer(c Config) (*Server, error) {
+	p, err := New(c)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	srv := httptest.NewServer(p)
+	p.config.Issuer = srv.URL
+	return &Server{Server: srv, Provider: p}, nil
+}
+
+func (p *Provider) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	p.mux.ServeHTTP(w, r)
+}
+
+// Issuer returns issuer of the provider
+func (p *Provider) Issuer() string {
+	return strings.TrimSuffix(p.config.Issuer, "/")
+}
+
+// OIDCConfig returns config of the proxy which uses the provider with form_post
+func (p *Provider) OIDCConfig(redirectURL string) oidc.Config {
+	clientID := p.config.ClientID
+	if len(clientID) < 1 {
+		clientID = "oidctest"
+	}
+	return oidc.Config{
+		ClientID:     clientID,
+		ClientSecret: secret.Value(p.config.ClientSecret),
+		Endpoint: oidc.Endpoint{
+			AuthURL:       p.Issuer() + AuthorizePath,
+			TokenURL:      p.Issuer() + TokenPath,
+			DeviceAuthURL: p.Issuer() + DevicePath,
+		},
+		RedirectURL:  redirectURL,
+		JWKURL:       p.Issuer() + JWKSPath,
+		Scopes:       []string{"openid", "profile", "email"},
+		ResponseType: "id_token",
+		Issuers:      []string{p.Issuer()},
+		UserInfoURL:  p.Issuer() + UserInfoPath,
+	}
+}
+
+// SetClaims replaces claims of auto login user
+func (p *Provider) SetClaims(claims map[string]interface{}) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.config.Claims = claims
+}
+
+// SetModify replaces hook which changes claims of ID token
+func (p *Provider) SetModify(f func(claims map[string]interface{})) {
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	p.config.Modify = f
+}
+
+// IDToken signs ID token of the user for the client.
+// extra overrides standard claims and claims of the user.
+func (p *Provider) IDToken(clientID, nonce string, extra map[string]interface{}) (string, error) {
+	p.lock.Lock()
+	now := time.Now()
+	claims := jwt.MapClaims{}
+	for k, v := range p.config.Claims {
+		claims[k] = v
+	}
+	claims["iss"] = p.Issuer()
+	claims["aud"] = clientID
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(p.config.TokenLifetime).Unix()
+	claims["auth_time"] = now.Unix()
+	if len(nonce) > 0 {
+		claims["nonce"] = nonce
+	}
+	for k, v := range extra {
+		claims[k] = v
+	}
+	modify := p.config.Modify
+	p.lock.Unlock()
+	if modify != nil {
+		modify(claims)
+	}
+	return p.Sign(claims)
+}
+
+// Sign signs claims with key of the provider
+func (p *Provider) Sign(claims map[string]interface{}) (string, error) {
+	t := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims(claims))
+	t.Header["kid"] = keyID
+	s, err := t.SignedString(p.key)
+	return s, errors.WithStack(err)
+}
+
+// accessToken issues opaque access token for userinfo
+func (p *Provider) accessToken() string {
+	token := randomString()
+	p.lock.Lock()
+	defer p.lock.Unlock()
+	info := make(map[string]interface{}, len(p.config.Claims))
+	for k, v := range p.config.Claims {
+		info[k] = v
+	}
+	p.tokens[token] = info
+	return token
+}
+
+func (p *Provider) discovery(w http.ResponseWriter, r *http.Request) {
+	iss := p.Issuer()
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"issuer":                                iss,
+		"authorization_endpoint":                iss + AuthorizePath,
+		"token_endpoint":                        iss + TokenPath,
+		"jwks_uri":                              iss + JWKSPath,
+		"userinfo_endpoint":                     iss + UserInfoPath,
+		"end_session_endpoint":                  iss + EndSessionPath,
+		"device_authorization_endpoint":         iss + DevicePath,
+		"response_types_supported":              []string{"code", "id_token", "id_token token", "code id_token"},
+		"response_modes_supported":              []string{"query", "fragment", "form_post"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"code_challenge_methods_supported":      []string{"plain", "S256"},
+		"scopes_supported":                      []string{"openid", "profile", "email"},
+	})
+}
+
+// authorize logs in the user automatically and responds to redirect_uri
+func (p *Provider) authorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if r.Method == "POST" {
+		r.ParseForm()
+		q = r.Form
+	}
+	clientID := q.Get("client_id")
+	if len(p.config.ClientID) > 0 && clientID != p.config.ClientID {
+		http.Error(w, "unknown client_id", http.StatusBadRequest)
+		return
+	}
+	redirectURI, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil || !redirectURI.IsAbs() {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	types := strings.Fields(q.Get("response_type"))
+	if len(types) < 1 {
+		http.Error(w, "response_type is required", http.StatusBadRequest)
+		return
+	}
+
+	res := url.Values{}
+	if state := q.Get("state"); len(state) > 0 {
+		res.Set("state", state)
+	}
+	mode := "fragment"
+	for _, v := range types {
+		switch v {
+		case "code":
+			code := randomString()
+			p.lock.Lock()
+			p.codes[code] = &grant{
+				clientID:      clientID,
+				redirectURI:   redirectURI.String(),
+				nonce:         q.Get("nonce"),
+				challenge:     q.Get("code_challenge"),
+				challengeMode: q.Get("code_challenge_method"),
+				expireAt:      time.Now().Add(time.Minute),
+			}
+			p.lock.Unlock()
+			res.Set("code", code)
+			if len(types) == 1 {
+				mode = "query"
+			}
+		case "id_token":
+			token, err := p.IDToken(clientID, q.Get("nonce"), nil)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			res.Set("id_token", token)
+		case "token":
+			res.Set("access_token", p.accessToken())
+			res.Set("token_type", "Bearer")
+			res.Set("expires_in", strconv.Itoa(int(p.config.TokenLifetime/time.Second)))
+		default:
+			http.Error(w, "unsupported response_type", http.StatusBadRequest)
+			return
+		}
+	}
+	if m := q.Get("response_mode"); len(m) > 0 {
+		mode = m
+	}
+
+	switch mode {
+	case "form_post":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		formPost.Execute(w, map[string]interface{}{
+			"Action": redirectURI.String(),
+			"Values": res,
+		})
+	case "query":
+		v := redirectURI.Query()
+		for k := range res {
+			v.Set(k, res.Get(k))
+		}
+		redirectURI.RawQuery = v.Encode()
+		http.Redirect(w, r, redirectURI.String(), http.StatusFound)
+	default:
+		redirectURI.Fragment = ""
+		http.Redirect(w, r, redirectURI.String()+"#"+res.Encode(), http.StatusFound)
+	}
+}
+
+// formPost is auto submit form of response_mode=form_post
+var formPost = template.Must(template.New("form_post").Parse(`<!DOCTYPE html>
+<html><head><title>Submit</title></head>
+<body onload="document.forms[0].submit()">
+<form method="post" action="{{.Action}}">
+{{range $k, $v := .Values}}<input type="hidden" name="{{$k}}" value="{{index $v 0}}"/>
+{{end}}<noscript><button type="submit">Continue</button></noscript>
+</form>
+</body></html>
+`))
+
+// token exchanges authorization code
+func (p *Provider) token(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		tokenError(w, "invalid_request", "POST is required")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	switch gt := r.PostForm.Get("grant_type"); gt {
+	case "authorization_code":
+	case oidc.DeviceGrantType:
+		p.deviceToken(w, r)
+		return
+	default:
+		tokenError(w, "unsupported_grant_type", gt)
+		return
+	}
+	code := r.PostForm.Get("code")
+	p.lock.Lock()
+	g, ok := p.codes[code]
+	delete(p.codes, code)
+	p.lock.Unlock()
+	if !ok || time.Now().After(g.expireAt) {
+		tokenError(w, "invalid_grant", "unknown code")
+		return
+	}
+	if r.PostForm.Get("redirect_uri") != g.redirectURI {
+		tokenError(w, "invalid_grant", "redirect_uri is not matched")
+		return
+	}
+
+	// client authentication or PKCE
+	clientID, secret, basic := r.BasicAuth()
+	if !basic {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	if clientID != g.clientID {
+		tokenError(w, "invalid_client", "client_id is not matched")
+		return
+	}
+	if len(g.challenge) > 0 {
+		if !verifyChallenge(g.challenge, g.challengeMode, r.PostForm.Get("code_verifier")) {
+			tokenError(w, "invalid_grant", "code_verifier is not matched")
+			return
+		}
+	} else if len(p.config.ClientSecret) > 0 && secret != p.config.ClientSecret {
+		tokenError(w, "invalid_client", "client_secret is not matched")
+		return
+	}
+
+	idToken, err := p.IDToken(g.clientID, g.nonce, nil)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": p.accessToken(),
+		"token_type":   "Bearer",
+		"expires_in":   int(p.config.TokenLifetime / time.Second),
+		"id_token":     idToken,
+	})
+}
+
+// device issues device code of RFC 8628
+func (p *Provider) device(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		tokenError(w, "invalid_request", "POST is required")
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		tokenError(w, "invalid_request", err.Error())
+		return
+	}
+	clientID := r.PostForm.Get("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID = id
+	}
+	if len(p.config.ClientID) > 0 && clientID != p.config.ClientID {
+		tokenError(w, "invalid_client", "unknown client_id")
+		return
+	}
+	code := randomString()
+	userCode := strings.ToUpper(randomString()[:8])
+	userCode = userCode[:4] + "-" + userCode[4:]
+	p.lock.Lock()
+	p.devices[code] = &deviceGrant{
+		clientID: clientID,
+		userCode: userCode,
+		expireAt: time.Now().Add(time.Minute * 10),
+	}
+	interval := p.config.DeviceInterval
+	p.lock.Unlock()
+	verify := p.Issuer() + DeviceVerifyPath
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"device_code":               code,
+		"user_code":                 userCode,
+		"verification_uri":          verify,
+		"verification_uri_complete": verify + "?user_code=" + url.QueryEscape(userCode),
+		"expires_in":                600,
+		"interval":                  interval,
+	})
+}
+
+// deviceVerify approves user_code as the auto login user
+func (p *Provider) deviceVerify(w http.ResponseWriter, r *http.Request) {
+	userCode := r.URL.Query().Get("user_code")
+	p.lock.Lock()
+	found := false
+	for _, g := range p.devices {
+		if len(userCode) > 0 && g.userCode == userCode {
+			g.approved = true
+			found = true
+		}
+	}
+	p.lock.Unlock()
+	w.Header().Set("Content-Type", "text/plain")
+	if !found {
+		http.Error(w, "unknown user_code", http.StatusBadRequest)
+		return
+	}
+	w.Write([]byte("Device approved\n"))
+}
+
+// deviceToken responds to polling of device code
+func (p *Provider) deviceToken(w http.ResponseWriter, r *http.Request) {
+	clientID := r.PostForm.Get("client_id")
+	if id, _, ok := r.BasicAuth(); ok {
+		clientID = id
+	}
+	code := r.PostForm.Get("device_code")
+	now := time.Now()
+	p.lock.Lock()
+	g, ok := p.devices[code]
+	var status string
+	switch {
+	case !ok || g.clientID != clientID:
+		status = "invalid_grant"
+	case now.After(g.expireAt):
+		status = oidc.ErrExpiredToken
+		delete(p.devices, code)
+	case !g.approved && now.Sub(g.lastPoll) < time.Duration(p.config.DeviceInterval)*time.Second:
+		status = oidc.ErrSlowDown
+	case !g.approved:
+		status = oidc.ErrAuthorizationPending
+	default:
+		delete(p.devices, code)
+	}
+	if ok {
+		g.lastPoll = now
+	}
+	p.lock.Unlock()
+	if len(status) > 0 {
+		tokenError(w, status, "")
+		return
+	}
+
+	idToken, err := p.IDToken(clientID, "", nil)
+	if err != nil {
+		tokenError(w, "server_error", err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"access_token": p.accessToken(),
+		"token_type":   "Bearer",
+		"expires_in":   int(p.config.TokenLifetime / time.Second),
+		"id_token":     idToken,
+	})
+}
+
+// verifyChallenge verifies PKCE of RFC 7636
+func verifyChallenge(challenge, method, verifier string) bool {
+	switch method {
+	case "", "plain":
+		return challenge == verifier
+	case "S256":
+		sum := sha256.Sum256([]byte(verifier))
+		return challenge == base64.RawURLEncoding.EncodeToString(sum[:])
+	}
+	return false
+}
+
+func (p *Provider) jwks(w http.ResponseWriter, r *http.Request) {
+	pub := p.key.PublicKey
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"use": "sig",
+			"alg": "RS256",
+			"kid": keyID,
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+}
+
+func (p *Provider) userinfo(w http.ResponseWriter, r *http.Request) {
+	token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+	p.lock.Lock()
+	info, ok := p.tokens[token]
+	p.lock.Unlock()
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+	writeJSON(w, http.StatusOK, info)
+}
+
+// endSession redirects to post_logout_redirect_uri
+func (p *Provider) endSession(w http.ResponseWriter, r *http.Request) {
+	u := r.URL.Query().Get("post_logout_redirect_uri")
+	if len(u) < 1 {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("Logged out\n"))
+		return
+	}
+	ru, err := url.Parse(u)
+	if err != nil || !ru.IsAbs() {
+		http.Error(w, "invalid post_logout_redirect_uri", http.StatusBadRequest)
+		return
+	}
+	if state := r.URL.Query().Get("state"); len(state) > 0 {
+		v := ru.Query()
+		v.Set("state", state)
+		ru.RawQuery = v.Encode()
+	}
+	http.Redirect(w, r, ru.String(), http.StatusFound)
+}
+
+func tokenError(w http.ResponseWriter, code, desc string) {
+	status := http.StatusBadRequest
+	if code == "invalid_client" {
+		status = http.StatusUnauthorized
+	}
+	writeJSON(w, status, map[string]string{
+		"error":             code,
+		"error_description": desc,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,241 @@
+package oidctest_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/oidctest"
+)
+
+// noRedirect returns response of redirect as is
+var noRedirect = &http.Client{
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+func newServer(t *testing.T) *oidctest.Server {
+	srv, err := oidctest.NewServer(oidctest.Config{
+		ClientID:     "client",
+		ClientSecret: "secret",
+		Claims: map[string]interface{}{
+			"sub":   "248289761001",
+			"email": "jane@example.com",
+		},
+	})
+	checkError(t, err)
+	return srv
+}
+
+func keyfunc(t *testing.T, srv *oidctest.Server) func(string) (*oidc.IDTokenClaims, error) {
+	res, err := http.Get(srv.URL + oidctest.JWKSPath)
+	checkError(t, err)
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	checkError(t, err)
+	kf, err := oidc.ParseJWK(b)
+	checkError(t, err)
+	return func(token string) (*oidc.IDTokenClaims, error) {
+		return oidc.ParseIDToken(token, kf)
+	}
+}
+
+func TestDiscovery(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	res, err := http.Get(srv.URL + oidctest.DiscoveryPath)
+	checkError(t, err)
+	defer res.Body.Close()
+	var doc map[string]interface{}
+	checkError(t, json.NewDecoder(res.Body).Decode(&doc))
+	assert.Equal(t, srv.URL, doc["issuer"])
+	assert.Equal(t, srv.URL+oidctest.JWKSPath, doc["jwks_uri"])
+}
+
+func TestFormPost(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	c := srv.OIDCConfig("https://proxy.example.com/cb")
+	u := c.Endpoint.AuthURL + "?" + url.Values{
+		"client_id":     {c.ClientID},
+		"redirect_uri":  {c.RedirectURL},
+		"response_type": {"id_token token"},
+		"response_mode": {"form_post"},
+		"state":         {"af0ifjsldkj"},
+		"nonce":         {"n-0S6_WzA2Mj"},
+	}.Encode()
+	res, err := http.Get(u)
+	checkError(t, err)
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	checkError(t, err)
+	body := string(b)
+	assert.Contains(t, body, `action="https://proxy.example.com/cb"`)
+	assert.Contains(t, body, `name="state" value="af0ifjsldkj"`)
+
+	m := regexp.MustCompile(`name="id_token" value="([^"]+)"`).FindStringSubmatch(body)
+	if len(m) < 2 {
+		t.Fatalf("id_token is not posted: %s", body)
+	}
+	claims, err := keyfunc(t, srv)(m[1])
+	checkError(t, err)
+	assert.Equal(t, "248289761001", claims.Subject)
+	assert.Equal(t, oidc.Audience{"client"}, claims.Audience)
+	assert.Equal(t, srv.URL, claims.Issuer)
+	assert.Equal(t, "n-0S6_WzA2Mj", claims.Nonce)
+
+	// userinfo by access token
+	m = regexp.MustCompile(`name="access_token" value="([^"]+)"`).FindStringSubmatch(body)
+	if len(m) < 2 {
+		t.Fatalf("access_token is not posted: %s", body)
+	}
+	info, err := oidc.NewUserInfoClient(c.UserInfoURL).Fetch(context.Background(), m[1], "248289761001")
+	checkError(t, err)
+	assert.Equal(t, "jane@example.com", info["email"])
+}
+
+func TestCodeWithPKCE(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	verifier := "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	sum := sha256.Sum256([]byte(verifier))
+	redirectURI := "http://127.0.0.1:8765/callback"
+	u := srv.URL + oidctest.AuthorizePath + "?" + url.Values{
+		"client_id":             {"client"},
+		"redirect_uri":          {redirectURI},
+		"response_type":         {"code"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(sum[:])},
+		"code_challenge_method": {"S256"},
+	}.Encode()
+	res, err := noRedirect.Get(u)
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+	loc, err := url.Parse(res.Header.Get("Location"))
+	checkError(t, err)
+	assert.Equal(t, "xyz", loc.Query().Get("state"))
+	code := loc.Query().Get("code")
+
+	exchange := func(verifier string) *http.Response {
+		res, err := http.PostForm(srv.URL+oidctest.TokenPath, url.Values{
+			"grant_type":    {"authorization_code"},
+			"code":          {code},
+			"redirect_uri":  {redirectURI},
+			"client_id":     {"client"},
+			"code_verifier": {verifier},
+		})
+		checkError(t, err)
+		return res
+	}
+	// code is used once
+	res = exchange(verifier)
+	defer res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+	var tokens map[string]interface{}
+	checkError(t, json.NewDecoder(res.Body).Decode(&tokens))
+	_, err = keyfunc(t, srv)(tokens["id_token"].(string))
+	checkError(t, err)
+	res = exchange(verifier)
+	res.Body.Close()
+	assert.Equal(t, 400, res.StatusCode)
+}
+
+func TestModify(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	srv.SetModify(func(claims map[string]interface{}) {
+		claims["aud"] = "other"
+	})
+	token, err := srv.IDToken("client", "n-0S6_WzA2Mj", nil)
+	checkError(t, err)
+	claims, err := keyfunc(t, srv)(token)
+	checkError(t, err)
+	assert.Equal(t, oidc.Audience{"other"}, claims.Audience)
+}
+
+func TestEndSession(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	res, err := noRedirect.Get(srv.URL + oidctest.EndSessionPath + "?" + url.Values{
+		"post_logout_redirect_uri": {"https://proxy.example.com/"},
+		"state":                    {"abc"},
+	}.Encode())
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+	assert.True(t, strings.HasPrefix(res.Header.Get("Location"), "https://proxy.example.com/?state=abc"))
+}
+
+func checkError(t *testing.T, err error) {
+	if err != nil {
+		t.Logf("%+v", errors.WithStack(err))
+		t.FailNow()
+	}
+}
+
+func TestDevice(t *testing.T) {
+	srv := newServer(t)
+	defer srv.Close()
+	c := srv.OIDCConfig("")
+	da, err := oidc.RequestDeviceCode(context.Background(), nil, &c)
+	checkError(t, err)
+	assert.Equal(t, srv.URL+oidctest.DeviceVerifyPath, da.VerificationURI)
+	assert.Equal(t, 5, da.Interval)
+
+	poll := func() (map[string]interface{}, int) {
+		res, err := http.PostForm(c.Endpoint.TokenURL, url.Values{
+			"grant_type":  {oidc.DeviceGrantType},
+			"device_code": {da.DeviceCode},
+			"client_id":   {"client"},
+		})
+		checkError(t, err)
+		defer res.Body.Close()
+		var v map[string]interface{}
+		checkError(t, json.NewDecoder(res.Body).Decode(&v))
+		return v, res.StatusCode
+	}
+	v, _ := poll()
+	assert.Equal(t, oidc.ErrAuthorizationPending, v["error"])
+	v, _ = poll()
+	assert.Equal(t, oidc.ErrSlowDown, v["error"])
+
+	res, err := http.Get(srv.URL + oidctest.DeviceVerifyPath + "?user_code=unknown")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 400, res.StatusCode)
+	res, err = http.Get(da.VerificationURIComplete)
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, 200, res.StatusCode)
+
+	v, code := poll()
+	assert.Equal(t, 200, code)
+	res, err = http.Get(srv.URL + oidctest.JWKSPath)
+	checkError(t, err)
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	checkError(t, err)
+	kf, err := oidc.ParseJWK(b)
+	checkError(t, err)
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(v["id_token"].(string), claims, kf)
+	checkError(t, err)
+	assert.Equal(t, "248289761001", claims["sub"])
+	assert.Nil(t, claims["nonce"])
+	v, _ = poll()
+	assert.Equal(t, "invalid_grant", v["error"])
+}
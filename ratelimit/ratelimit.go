@@ -0,0 +1,102 @@
+// Package ratelimit limits requests by token bucket.
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"sync"
+	"time"
+)
+
+// Limit is rate of token bucket.
+// Requests tokens are refilled in Per and bucket holds Burst tokens.
+type Limit struct {
+	Requests int           `json:"requests" yaml:"requests"`
+	Per      time.Duration `json:"per" yaml:"per"`
+	// Burst is size of bucket. default is Requests
+	Burst int `json:"burst" yaml:"burst"`
+}
+
+// rate returns tokens per second
+func (l Limit) rate() float64 {
+	if l.Requests < 1 || l.Per <= 0 {
+		return 0
+	}
+	return float64(l.Requests) / l.Per.Seconds()
+}
+
+func (l Limit) burst() float64 {
+	if l.Burst > 0 {
+		return float64(l.Burst)
+	}
+	return float64(l.Requests)
+}
+
+// Store keeps token buckets by key.
+// Implement on shared storage to share limits between replicas.
+type Store interface {
+	// Take consumes a token of the key.
+	// It returns false and duration until next token when the bucket is empty.
+	Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error)
+}
+
+// NewMemoryStore creates Store on memory of the process
+func NewMemoryStore() Store {
+	return &memoryStore{
+		lock:    new(sync.Mutex),
+		buckets: make(map[string]*bucket),
+		now:     time.Now,
+	}
+}
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time // bucket is full after this
+}
+
+type memoryStore struct {
+	lock    *sync.Mutex
+	buckets map[string]*bucket
+	pruned  time.Time
+	now     func() time.Time
+}
+
+func (m *memoryStore) Take(ctx context.Context, key string, l Limit) (bool, time.Duration, error) {
+	rate, burst := l.rate(), l.burst()
+	if rate <= 0 {
+		return true, 0, nil
+	}
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	now := m.now()
+	m.prune(now)
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: burst, last: now}
+		m.buckets[key] = b
+	}
+	b.tokens = math.Min(burst, b.tokens+now.Sub(b.last).Seconds()*rate)
+	b.last = now
+	if b.tokens < 1 {
+		wait := time.Duration((1 - b.tokens) / rate * float64(time.Second))
+		return false, wait, nil
+	}
+	b.tokens--
+	b.full = now.Add(time.Duration((burst - b.tokens) / rate * float64(time.Second)))
+	return true, 0, nil
+}
+
+// prune removes full buckets at most every minute
+func (m *memoryStore) prune(now time.Time) {
+	if now.Sub(m.pruned) < time.Minute {
+		return
+	}
+	m.pruned = now
+	for k, v := range m.buckets {
+		if now.After(v.full) {
+			delete(m.buckets, k)
+		}
+	}
+}
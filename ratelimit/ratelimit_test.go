@@ -0,0 +1,59 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Unix(1553000000, 0)
+	s := NewMemoryStore().(*memoryStore)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+	l := Limit{Requests: 2, Per: time.Second, Burst: 3}
+
+	// burst
+	for i := 0; i < 3; i++ {
+		ok, _, err := s.Take(ctx, "a", l)
+		checkError(t, err)
+		assert.True(t, ok)
+	}
+	ok, wait, err := s.Take(ctx, "a", l)
+	checkError(t, err)
+	assert.False(t, ok)
+	assert.Equal(t, time.Millisecond*500, wait)
+
+	// other key has own bucket
+	ok, _, err = s.Take(ctx, "b", l)
+	checkError(t, err)
+	assert.True(t, ok)
+
+	// refill
+	now = now.Add(time.Millisecond * 500)
+	ok, _, err = s.Take(ctx, "a", l)
+	checkError(t, err)
+	assert.True(t, ok)
+	ok, _, err = s.Take(ctx, "a", l)
+	checkError(t, err)
+	assert.False(t, ok)
+
+	// full buckets are pruned
+	now = now.Add(time.Minute)
+	s.Take(ctx, "c", l)
+	assert.Len(t, s.buckets, 1)
+
+	// zero limit is unlimited
+	ok, _, err = s.Take(ctx, "a", Limit{})
+	checkError(t, err)
+	assert.True(t, ok)
+}
+
+func checkError(t *testing.T, err error) {
+	if err != nil {
+		t.Logf("%+v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,198 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/oidc"
+)
+
+// AdminConfig is setting of session admin API
+type AdminConfig struct {
+	// Claim and Values are policy of administrators.
+	// ID token which has one of Values in Claim is accepted. e.g. groups: [authproxy-admin]
+	Claim  string   `json:"claim" yaml:"claim"`
+	Values []string `json:"values" yaml:"values"`
+}
+
+// allowed reports claims satisfy the policy
+func (c AdminConfig) allowed(claims map[string]interface{}) bool {
+	if len(c.Claim) < 1 || len(c.Values) < 1 {
+		return false
+	}
+	x, ok := lookupClaim(claims, strings.Split(c.Claim, "."))
+	if !ok {
+		return false
+	}
+	var list []interface{}
+	switch v := x.(type) {
+	case []interface{}:
+		list = v
+	default:
+		list = []interface{}{v}
+	}
+	for _, e := range list {
+		s := formatClaim(e, "")
+		for _, v := range c.Values {
+			if s == v {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SessionsResponse is body of session list
+type SessionsResponse struct {
+	Sessions []session.Record `json:"sessions"`
+}
+
+// SessionAdmin serves API to list and revoke logged in sessions.
+// Caller presents ID token as bearer token which satisfies the policy.
+//
+//	GET    /            list sessions. ?sub= filters by user
+//	DELETE /{id}        revoke the session
+//	DELETE /?sub={sub}  revoke all sessions of the user
+//
+// Recommended to mount on "/admin/sessions" of admin listener
+func (rt *router) SessionAdmin(v oidc.TokenVerifier, c AdminConfig) http.Handler {
+	r := chi.NewRouter()
+	r.Use(rt.adminAuth(v, c))
+	r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+		list, err := rt.astore.Sessions(r.Context())
+		if err != nil {
+			writeJSONError(w, err.Error(), 503)
+			return
+		}
+		res := SessionsResponse{Sessions: []session.Record{}}
+		sub := r.URL.Query().Get("sub")
+		for _, v := range list {
+			if len(sub) > 0 && v.Subject != sub {
+				continue
+			}
+			res.Sessions = append(res.Sessions, v)
+		}
+		writeJSON(w, http.StatusOK, res)
+	})
+	r.Delete("/", func(w http.ResponseWriter, r *http.Request) {
+		sub := r.URL.Query().Get("sub")
+		if len(sub) < 1 {
+			writeJSONError(w, "sub is required", 400)
+			return
+		}
+		list, err := rt.astore.RevokeSubject(r.Context(), sub)
+		for _, v := range list {
+			rt.auditRevoked(r, v)
+		}
+		if err != nil {
+			writeJSONError(w, err.Error(), 503)
+			return
+		}
+		writeJSON(w, http.StatusOK, SessionsResponse{Sessions: append([]session.Record{}, list...)})
+	})
+	r.Delete("/{id}", func(w http.ResponseWriter, r *http.Request) {
+		id := chi.URLParam(r, "id")
+		var rec *session.Record
+		list, err := rt.astore.Sessions(r.Context())
+		if err != nil {
+			writeJSONError(w, err.Error(), 503)
+			return
+		}
+		for i := range list {
+			if list[i].ID == id {
+				rec = &list[i]
+			}
+		}
+		if rec == nil {
+			writeJSONError(w, session.ErrNotFound.Error(), 404)
+			return
+		}
+		err = rt.astore.Revoke(r.Context(), id)
+		if errors.Cause(err) == session.ErrNotFound {
+			writeJSONError(w, err.Error(), 404)
+			return
+		} else if err != nil {
+			writeJSONError(w, err.Error(), 503)
+			return
+		}
+		rt.auditRevoked(r, *rec)
+		writeJSON(w, http.StatusOK, SessionsResponse{Sessions: []session.Record{*rec}})
+	})
+	return r
+}
+
+// adminAuth accepts bearer ID token which satisfies the policy
+func (rt *router) adminAuth(v oidc.TokenVerifier, c AdminConfig) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			auth := r.Header.Get("Authorization")
+			token := strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+			if !strings.HasPrefix(auth, "Bearer ") || len(token) < 1 {
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				writeJSONError(w, "Bearer token is required", 401)
+				return
+			}
+			claims, err := v.VerifyToken(token)
+			if err != nil {
+				w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+				writeJSONError(w, err.Error(), 401)
+				return
+			}
+			if !c.allowed(claims) {
+				sub, _ := claims["sub"].(string)
+				rt.audit(r, logging.EventAuthorizationDenied, nil, logrus.Fields{
+					"reason": "admin_policy",
+					"sub":    sub,
+				})
+				writeJSONError(w, "Not administrator", 403)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(contextWithAdmin(r.Context(), claims)))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+var (
+	// adminKey holds claims of administrator
+	adminKey = &contextKey{"admin"}
+)
+
+func contextWithAdmin(ctx context.Context, claims map[string]interface{}) context.Context {
+	return context.WithValue(ctx, adminKey, claims)
+}
+
+func adminClaims(r *http.Request) map[string]interface{} {
+	claims, _ := r.Context().Value(adminKey).(map[string]interface{})
+	return claims
+}
+
+// auditRevoked records revocation with administrator of the request
+func (rt *router) auditRevoked(r *http.Request, rec session.Record) {
+	admin, _ := adminClaims(r)["sub"].(string)
+	rt.audit(r, logging.EventSessionRevoked, &session.AuthInfo{
+		Subject:  rec.Subject,
+		Username: rec.Username,
+	}, logrus.Fields{
+		"session_id": rec.ID,
+		"admin":      admin,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, msg string, code int) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
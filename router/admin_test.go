@@ -0,0 +1,79 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+// fakeVerifier accepts token which is key of claims
+type fakeVerifier map[string]map[string]interface{}
+
+func (f fakeVerifier) VerifyToken(token string) (map[string]interface{}, error) {
+	if claims, ok := f[token]; ok {
+		return claims, nil
+	}
+	return nil, errors.New("invalid token")
+}
+
+func TestSessionAdmin(t *testing.T) {
+	tp := newTestProxy(t, nil)
+	defer tp.Close()
+	admin := tp.rp.SessionAdmin(fakeVerifier{
+		"admin": {"sub": "admin", "groups": []interface{}{"users", "authproxy-admin"}},
+		"user":  {"sub": "user", "groups": []interface{}{"users"}},
+	}, router.AdminConfig{Claim: "groups", Values: []string{"authproxy-admin"}})
+
+	call := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		if len(token) > 0 {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rec := httptest.NewRecorder()
+		admin.ServeHTTP(rec, req)
+		return rec
+	}
+	list := func(path string) []session.Record {
+		rec := call("GET", path, "admin")
+		assert.Equal(t, 200, rec.Code)
+		var res router.SessionsResponse
+		checkError(t, json.NewDecoder(rec.Body).Decode(&res))
+		return res.Sessions
+	}
+
+	// authentication and policy
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/", "").Code)
+	assert.Equal(t, http.StatusUnauthorized, call("GET", "/", "forged").Code)
+	assert.Equal(t, http.StatusForbidden, call("GET", "/", "user").Code)
+
+	exp := time.Now().Add(time.Hour)
+	jane1 := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: exp, Subject: "jane", LoginAt: time.Now(), RemoteIP: "192.0.2.1", UserAgent: "test"})
+	jane2 := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: exp, Subject: "jane", LoginAt: time.Now()})
+	john := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: exp, Subject: "john", LoginAt: time.Now()})
+
+	all := list("/")
+	assert.Len(t, all, 3)
+	assert.Equal(t, "192.0.2.1", all[0].RemoteIP)
+	assert.Equal(t, "test", all[0].UserAgent)
+	assert.Len(t, list("/?sub=jane"), 2)
+
+	// revoke by id
+	assert.Equal(t, 404, call("DELETE", "/unknown", "admin").Code)
+	assert.Equal(t, 200, call("DELETE", "/"+list("/?sub=john")[0].ID, "admin").Code)
+	assert.Equal(t, 401, tp.get("/private/a", john).Code)
+	assert.Equal(t, 200, tp.get("/private/a", jane1).Code)
+
+	// revoke by sub
+	assert.Equal(t, 400, call("DELETE", "/", "admin").Code)
+	assert.Equal(t, 200, call("DELETE", "/?sub=jane", "admin").Code)
+	assert.Equal(t, 401, tp.get("/private/a", jane1).Code)
+	assert.Equal(t, 401, tp.get("/private/a", jane2).Code)
+	assert.Len(t, list("/"), 0)
+}
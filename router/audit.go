@@ -0,0 +1,62 @@
+package router
+
+import (
+	"net/http"
+
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/metrics"
+	"github.com/uzuna/go-authproxy/oidc"
+)
+
+// audit records security event with client and user of the request
+func (rt *router) audit(r *http.Request, ev logging.Event, ainfo *session.AuthInfo, fields logrus.Fields) {
+	if rt.auditor == nil {
+		return
+	}
+	f := logrus.Fields{
+		"remote_ip": rt.Client(r).IP,
+		"path":      r.URL.Path,
+	}
+	if ainfo != nil {
+		f["sub"] = ainfo.Subject
+		f["username"] = ainfo.Username
+	}
+	for k, v := range fields {
+		f[k] = v
+	}
+	rt.auditor.Log(r, ev, f)
+}
+
+// loginFailure counts and records failure of login
+func (rt *router) loginFailure(r *http.Request, reason string, err error) {
+	metrics.ObserveLogin(false, reason)
+	rt.audit(r, logging.EventLoginFailure, nil, logrus.Fields{
+		"reason": reason,
+		"error":  err.Error(),
+	})
+}
+
+// usernameOfClaims picks display name of user from verified claims
+func usernameOfClaims(claims map[string]interface{}) string {
+	for _, k := range []string{"preferred_username", "email", "name"} {
+		if v, ok := claims[k].(string); ok && len(v) > 0 {
+			return v
+		}
+	}
+	return ""
+}
+
+// authErrorMessage returns message of authentication failure for the user
+func authErrorMessage(err error) string {
+	switch oidc.ErrorReason(err) {
+	case oidc.ReasonExpired:
+		return "ID token is expired. Please login again."
+	case oidc.ReasonNotBefore, oidc.ReasonIssuedAt:
+		return "ID token is not valid yet. Clock of the proxy may differ from the provider."
+	case oidc.ReasonAuthTime:
+		return "Authentication is too old. Please login again."
+	}
+	return err.Error()
+}
@@ -0,0 +1,79 @@
+package router
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/oidc"
+)
+
+// bearerTokenKey holds bearer token captured before StripHeaders removes Authorization
+var bearerTokenKey = &contextKey{"bearertoken"}
+
+// BearerTokens accepts ID token of the provider in Authorization header
+// as authentication of the request without session.
+// It is for CLI tools which obtain the token by themselves.
+func BearerTokens(v oidc.TokenVerifier) Option {
+	return func(rt *router) {
+		rt.bearer = v
+	}
+}
+
+// bearerToken returns token of "Authorization: Bearer"
+func bearerToken(h http.Header) string {
+	auth := h.Get("Authorization")
+	if len(auth) < 7 || !strings.EqualFold(auth[:7], "Bearer ") {
+		return ""
+	}
+	return strings.TrimSpace(auth[7:])
+}
+
+// authenticateBearer verifies captured bearer token and replaces authinfo of the request.
+// The authinfo is never saved to session. It returns false after responding error.
+func (rt *router) authenticateBearer(w http.ResponseWriter, r *http.Request) (*http.Request, bool) {
+	token, _ := r.Context().Value(bearerTokenKey).(string)
+	if rt.bearer == nil || len(token) < 1 {
+		return r, true
+	}
+	claims, err := rt.bearer.VerifyToken(token)
+	if err != nil {
+		fields := logrus.Fields{"reason": oidc.ErrorReason(err), "error": err.Error()}
+		rt.audit(r, logging.EventAuthorizationDenied, nil, fields)
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		rt.ep.Error(w, r, "Invalid bearer token", 401)
+		return r, false
+	}
+	ainfo := &session.AuthInfo{
+		LoggedIn: true,
+		Bearer:   true,
+		IDToken:  token,
+		Username: usernameOfClaims(claims),
+		RemoteIP: rt.Client(r).IP,
+	}
+	ainfo.Subject, _ = claims["sub"].(string)
+	ainfo.Claims, _ = encodeClaims(claims)
+	ainfo.ExpireAt = numericDate(claims["exp"])
+	ainfo.AuthTime = numericDate(claims["auth_time"])
+	return r.WithContext(context.WithValue(r.Context(), rt.authinfoKey, ainfo)), true
+}
+
+// numericDate converts NumericDate claim. zero when not found.
+func numericDate(v interface{}) time.Time {
+	var f float64
+	switch x := v.(type) {
+	case json.Number:
+		f, _ = x.Float64()
+	case float64:
+		f = x
+	}
+	if f <= 0 {
+		return time.Time{}
+	}
+	return time.Unix(int64(f), 0)
+}
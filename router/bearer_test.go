@@ -0,0 +1,61 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestBearerTokens(t *testing.T) {
+	exp := json.Number(strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	v := fakeVerifier{
+		"valid": {"sub": "jane", "preferred_username": "jane.doe", "exp": exp},
+	}
+	call := func(tp *testProxy, path, auth string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		if len(auth) > 0 {
+			req.Header.Set("Authorization", auth)
+		}
+		rec := httptest.NewRecorder()
+		tp.ServeHTTP(rec, req)
+		return rec
+	}
+
+	t.Run("enabled", func(t *testing.T) {
+		tp := newTestProxy(t, nil, router.BearerTokens(v))
+		defer tp.Close()
+
+		rec := call(tp, "/private/a", "Bearer valid")
+		assert.Equal(t, 200, rec.Code)
+		assert.Equal(t, "Bearer valid", tp.got.Get("Authorization"))
+		// session is not issued
+		assert.Len(t, rec.Result().Cookies(), 0)
+
+		rec = call(tp, "/private/a", "bearer valid")
+		assert.Equal(t, 200, rec.Code)
+
+		rec = call(tp, "/private/a", "Bearer forged")
+		assert.Equal(t, 401, rec.Code)
+		assert.Equal(t, `Bearer error="invalid_token"`, rec.Header().Get("WWW-Authenticate"))
+		rec = call(tp, "/public/a", "Bearer forged")
+		assert.Equal(t, 401, rec.Code)
+
+		// other schemes are removed as before
+		assert.Equal(t, 401, call(tp, "/private/a", "Basic dXNlcjpwYXNz").Code)
+		assert.Equal(t, 200, call(tp, "/public/a", "Basic dXNlcjpwYXNz").Code)
+		assert.Empty(t, tp.got.Get("Authorization"))
+	})
+
+	t.Run("disabled", func(t *testing.T) {
+		tp := newTestProxy(t, nil)
+		defer tp.Close()
+		assert.Equal(t, 401, call(tp, "/private/a", "Bearer valid").Code)
+		assert.Equal(t, 200, call(tp, "/public/a", "Bearer valid").Code)
+		assert.Empty(t, tp.got.Get("Authorization"))
+	})
+}
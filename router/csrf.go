@@ -0,0 +1,198 @@
+package router
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/logging"
+)
+
+// Mode of CSRF protection
+const (
+	CSRFModeNone         = ""
+	CSRFModeOrigin       = "origin"
+	CSRFModeDoubleSubmit = "double_submit"
+)
+
+// CSRFConfig is setting of CSRF protection for unsafe methods
+type CSRFConfig struct {
+	// Mode is "origin", "double_submit" or "" as disabled.
+	// "origin" checks Sec-Fetch-Site, Origin and Referer.
+	// "double_submit" requires header which equals to the token cookie.
+	Mode string `json:"mode" yaml:"mode"`
+	// TrustedOrigins are accepted cross origins. e.g. "https://app.example.com"
+	TrustedOrigins []string `json:"trusted_origins" yaml:"trusted_origins"`
+	// ExemptPaths are path prefixes which skip the check.
+	// e.g. APIs which are called with bearer token
+	ExemptPaths []string `json:"exempt_paths" yaml:"exempt_paths"`
+	// CookieName is name of token cookie of double_submit. default is "authproxy_csrf"
+	CookieName string `json:"cookie_name" yaml:"cookie_name"`
+	// HeaderName is name of token header of double_submit. default is "X-CSRF-Token"
+	HeaderName string `json:"header_name" yaml:"header_name"`
+}
+
+// CallbackOrigins sets origins which are accepted as Origin of the callback.
+// form_post from the provider has Origin of the provider.
+// Callback without Origin or with "null" is accepted for privacy settings of browsers.
+func CallbackOrigins(origins ...string) Option {
+	return func(rt *router) {
+		for _, v := range origins {
+			rt.callbackOrigins = append(rt.callbackOrigins, strings.TrimSuffix(v, "/"))
+		}
+	}
+}
+
+// CSRF rejects cross-site requests of unsafe methods.
+// Recommended to insert after AuthRedirect of the certification route
+func (rt *router) CSRF(c CSRFConfig) (func(next http.Handler) http.Handler, error) {
+	if len(c.CookieName) < 1 {
+		c.CookieName = "authproxy_csrf"
+	}
+	if len(c.HeaderName) < 1 {
+		c.HeaderName = "X-CSRF-Token"
+	}
+	origins := make(map[string]struct{}, len(c.TrustedOrigins))
+	for _, v := range c.TrustedOrigins {
+		origins[strings.TrimSuffix(v, "/")] = struct{}{}
+	}
+
+	var check func(w http.ResponseWriter, r *http.Request) error
+	switch c.Mode {
+	case CSRFModeNone:
+		return func(next http.Handler) http.Handler { return next }, nil
+	case CSRFModeOrigin:
+		check = func(w http.ResponseWriter, r *http.Request) error {
+			return rt.checkOrigin(r, origins)
+		}
+	case CSRFModeDoubleSubmit:
+		check = func(w http.ResponseWriter, r *http.Request) error {
+			return checkDoubleSubmit(w, r, c.CookieName, c.HeaderName, rt.Client(r).Proto == "https")
+		}
+	default:
+		return nil, errors.Errorf("Unknown CSRF mode [%s]", c.Mode)
+	}
+
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			// bearer token is not sent by browser automatically
+			if ainfo, err := rt.AuthInfo(r); err == nil && ainfo.Bearer {
+				next.ServeHTTP(w, r)
+				return
+			}
+			for _, v := range c.ExemptPaths {
+				if strings.HasPrefix(r.URL.Path, v) {
+					next.ServeHTTP(w, r)
+					return
+				}
+			}
+			if err := check(w, r); err != nil {
+				ainfo, _ := rt.AuthInfo(r)
+				rt.audit(r, logging.EventAuthorizationDenied, ainfo, logrus.Fields{
+					"reason": "csrf",
+					"error":  err.Error(),
+				})
+				rt.ep.Error(w, r, err.Error(), 403)
+				return
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}, nil
+}
+
+// safeMethod reports the method does not change state
+func safeMethod(method string) bool {
+	switch method {
+	case "GET", "HEAD", "OPTIONS", "TRACE":
+		return true
+	}
+	return false
+}
+
+// checkOrigin accepts same origin or trusted origins
+func (rt *router) checkOrigin(r *http.Request, origins map[string]struct{}) error {
+	if safeMethod(r.Method) {
+		return nil
+	}
+	switch r.Header.Get("Sec-Fetch-Site") {
+	case "same-origin", "none":
+		return nil
+	}
+	origin := r.Header.Get("Origin")
+	if len(origin) < 1 || origin == "null" {
+		ref, err := url.Parse(r.Referer())
+		if err != nil || len(ref.Host) < 1 {
+			return errors.Errorf("Missing Origin and Referer")
+		}
+		origin = ref.Scheme + "://" + ref.Host
+	}
+	if origin == rt.Client(r).Origin() {
+		return nil
+	}
+	if _, ok := origins[origin]; ok {
+		return nil
+	}
+	return errors.Errorf("Cross origin request from [%s]", origin)
+}
+
+// checkDoubleSubmit issues token cookie on safe methods
+// and compares it with the header on unsafe methods
+func checkDoubleSubmit(w http.ResponseWriter, r *http.Request, cookieName, headerName string, secure bool) error {
+	c, err := r.Cookie(cookieName)
+	if safeMethod(r.Method) {
+		if err != nil || len(c.Value) < 1 {
+			token, err := newCSRFToken()
+			if err != nil {
+				return errors.WithStack(err)
+			}
+			// readable from script to copy to the header
+			http.SetCookie(w, &http.Cookie{
+				Name:     cookieName,
+				Value:    token,
+				Path:     "/",
+				Secure:   secure,
+				SameSite: http.SameSiteStrictMode,
+			})
+		}
+		return nil
+	}
+	if err != nil || len(c.Value) < 1 {
+		return errors.Errorf("Missing CSRF cookie")
+	}
+	token := r.Header.Get(headerName)
+	if subtle.ConstantTimeCompare([]byte(token), []byte(c.Value)) != 1 {
+		return errors.Errorf("Unmatch CSRF token")
+	}
+	return nil
+}
+
+func newCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// checkCallbackOrigin rejects callback posted from unknown origin
+func (rt *router) checkCallbackOrigin(r *http.Request) error {
+	if len(rt.callbackOrigins) < 1 {
+		return nil
+	}
+	origin := r.Header.Get("Origin")
+	if len(origin) < 1 || origin == "null" {
+		return nil
+	}
+	for _, v := range rt.callbackOrigins {
+		if origin == v {
+			return nil
+		}
+	}
+	return errors.Errorf("Unexpected callback origin [%s]", origin)
+}
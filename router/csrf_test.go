@@ -0,0 +1,126 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+// newCSRFMux mounts CSRF protected route "/app/*" and exempt "/app/api/*"
+func newCSRFMux(t *testing.T, tp *testProxy, mode string) *chi.Mux {
+	csrf, err := tp.rp.CSRF(router.CSRFConfig{
+		Mode:           mode,
+		TrustedOrigins: []string{"https://app.example.com"},
+		ExemptPaths:    []string{"/app/api/"},
+	})
+	checkError(t, err)
+	r := chi.NewRouter()
+	r.Use(tp.rp.ResolveClient())
+	r.Use(tp.rp.LoadSession())
+	r.Route("/app", func(r chi.Router) {
+		r.Use(tp.rp.AuthRedirect())
+		r.Use(csrf)
+		r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	return r
+}
+
+func TestCSRFOrigin(t *testing.T) {
+	tp := newTestProxy(t, nil)
+	defer tp.Close()
+	c := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: time.Now().Add(time.Hour)})
+	mux := newCSRFMux(t, tp, router.CSRFModeOrigin)
+
+	table := []struct {
+		method string
+		path   string
+		header map[string]string
+		code   int
+	}{
+		{"GET", "/app/x", nil, 200},
+		{"POST", "/app/x", nil, 403},
+		{"POST", "/app/x", map[string]string{"Sec-Fetch-Site": "same-origin"}, 200},
+		{"POST", "/app/x", map[string]string{"Sec-Fetch-Site": "cross-site", "Origin": "https://evil.example.com"}, 403},
+		{"POST", "/app/x", map[string]string{"Origin": "http://example.com"}, 200},
+		{"DELETE", "/app/x", map[string]string{"Origin": "https://app.example.com"}, 200},
+		{"PUT", "/app/x", map[string]string{"Origin": "null", "Referer": "https://evil.example.com/form"}, 403},
+		{"PUT", "/app/x", map[string]string{"Referer": "http://example.com/form"}, 200},
+		{"POST", "/app/api/x", map[string]string{"Origin": "https://evil.example.com"}, 200},
+	}
+	for _, v := range table {
+		req := httptest.NewRequest(v.method, v.path, nil)
+		req.AddCookie(c)
+		for k, hv := range v.header {
+			req.Header.Set(k, hv)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		assert.Equal(t, v.code, rec.Code, "%s %s %v", v.method, v.path, v.header)
+	}
+}
+
+func TestCSRFDoubleSubmit(t *testing.T) {
+	tp := newTestProxy(t, nil)
+	defer tp.Close()
+	c := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: time.Now().Add(time.Hour)})
+	mux := newCSRFMux(t, tp, router.CSRFModeDoubleSubmit)
+
+	// safe method issues token
+	req := httptest.NewRequest("GET", "/app/x", nil)
+	req.AddCookie(c)
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, 200, rec.Code)
+	var token *http.Cookie
+	for _, v := range rec.Result().Cookies() {
+		if v.Name == "authproxy_csrf" {
+			token = v
+		}
+	}
+	if token == nil {
+		t.Fatalf("csrf cookie is not issued")
+	}
+	assert.False(t, token.HttpOnly)
+
+	post := func(header string) int {
+		req := httptest.NewRequest("POST", "/app/x", nil)
+		req.AddCookie(c)
+		req.AddCookie(token)
+		if len(header) > 0 {
+			req.Header.Set("X-CSRF-Token", header)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec.Code
+	}
+	assert.Equal(t, 403, post(""))
+	assert.Equal(t, 403, post("forged"))
+	assert.Equal(t, 200, post(token.Value))
+}
+
+func TestCSRFUnknownMode(t *testing.T) {
+	tp := newTestProxy(t, nil)
+	defer tp.Close()
+	_, err := tp.rp.CSRF(router.CSRFConfig{Mode: "token"})
+	assert.Error(t, err)
+}
+
+func TestCallbackOrigin(t *testing.T) {
+	tp := newTestProxy(t, nil, router.CallbackOrigins("https://idp.example.com/"))
+	defer tp.Close()
+	mux := chi.NewRouter()
+	mux.Use(tp.rp.LoadSession())
+	mux.Method("POST", "/cb", tp.rp.Authenticate())
+
+	req := httptest.NewRequest("POST", "/cb", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	assert.Equal(t, 403, rec.Code)
+}
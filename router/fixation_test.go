@@ -0,0 +1,135 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/quasoft/memstore"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/errorpage"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+// fakeAuth accepts any callback which has state
+type fakeAuth struct {
+	claims oidc.IDTokenClaims
+}
+
+func (f *fakeAuth) AuthURL(state string, opts ...oidc.URLOptionalParameter) (string, error) {
+	v := oidc.URLParams(opts...)
+	v.Set("state", state)
+	return "https://idp.example.com/auth?" + v.Encode(), nil
+}
+
+func (f *fakeAuth) Authenticate(r *http.Request) (*oidc.AuthResponse, error) {
+	claims := f.claims
+	return &oidc.AuthResponse{
+		IDToken: "header.payload.signature",
+		State:   r.PostFormValue("state"),
+		Claims:  &claims,
+	}, nil
+}
+
+// newLoginMux mounts login flow with fakeAuth
+func newLoginMux(t *testing.T, auth oidc.Authenticator, opts ...router.Option) *chi.Mux {
+	store := memstore.NewMemStore([]byte("authkey123"))
+	aikey := &contextKey{"authinfo"}
+	as := session.NewAuthStore(store, "demo", aikey)
+	ep, err := errorpage.NewErrorPages()
+	checkError(t, err)
+	rp := router.New(auth, as, ep, aikey, opts...)
+
+	r := chi.NewRouter()
+	r.Use(rp.LoadSession())
+	r.Method("GET", "/login", rp.Login(router.ReferrerMatch(regexp.MustCompile("^http://example.com/"))))
+	r.Method("POST", "/cb", rp.Authenticate())
+	r.Handle("/logout", rp.Logout())
+	r.Route("/private", func(r chi.Router) {
+		r.Use(rp.AuthRedirect())
+		r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	r.Route("/sensitive", func(r chi.Router) {
+		r.Use(rp.AuthRedirect())
+		r.Use(rp.RequireRecentAuth(time.Minute))
+		r.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {})
+	})
+	return r
+}
+
+// sessionCookie returns the last cookie of the name
+func sessionCookie(rec *httptest.ResponseRecorder) *http.Cookie {
+	var c *http.Cookie
+	for _, v := range rec.Result().Cookies() {
+		if v.Name == "demo" {
+			c = v
+		}
+	}
+	return c
+}
+
+func serve(h http.Handler, req *http.Request, c *http.Cookie) *httptest.ResponseRecorder {
+	if c != nil {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	return rec
+}
+
+// loginFlow runs login flow and returns cookies before and after the callback
+func loginFlow(t *testing.T, mux http.Handler) (pre, post *http.Cookie) {
+	rec := serve(mux, httptest.NewRequest("GET", "/login", nil), nil)
+	assert.Equal(t, 302, rec.Code)
+	pre = sessionCookie(rec)
+	if pre == nil {
+		t.Fatalf("session cookie is not issued on login")
+	}
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	checkError(t, err)
+
+	form := url.Values{"state": {loc.Query().Get("state")}}
+	req := httptest.NewRequest("POST", "/cb", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec = serve(mux, req, pre)
+	assert.Equal(t, 303, rec.Code)
+	post = sessionCookie(rec)
+	if post == nil {
+		t.Fatalf("session cookie is not issued on callback")
+	}
+	return pre, post
+}
+
+func TestSessionFixation(t *testing.T) {
+	mux := newLoginMux(t, &fakeAuth{claims: oidc.IDTokenClaims{
+		Subject:   "248289761001",
+		ExpireInt: time.Now().Add(time.Hour).Unix(),
+	}})
+	pre, post := loginFlow(t, mux)
+	assert.NotEqual(t, pre.Value, post.Value)
+
+	// pre-auth session is not authenticated
+	assert.Equal(t, 401, serve(mux, httptest.NewRequest("GET", "/private/a", nil), pre).Code)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/private/a", nil), post).Code)
+
+	// cross-site GET does not logout
+	rec := serve(mux, httptest.NewRequest("GET", "/logout", nil), post)
+	assert.Equal(t, 405, rec.Code)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/private/a", nil), post).Code)
+
+	// logout issues new session and destroys logged in session
+	rec = serve(mux, httptest.NewRequest("POST", "/logout", nil), post)
+	assert.Equal(t, 303, rec.Code)
+	out := sessionCookie(rec)
+	if assert.NotNil(t, out) {
+		assert.NotEqual(t, post.Value, out.Value)
+	}
+	assert.Equal(t, 401, serve(mux, httptest.NewRequest("GET", "/private/a", nil), post).Code)
+}
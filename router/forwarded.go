@@ -0,0 +1,249 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// clientInfoKey holds resolved client information
+	clientInfoKey = &contextKey{"clientinfo"}
+)
+
+// ClientInfo is information of the client resolved over trusted proxies
+type ClientInfo struct {
+	IP    string // client ip address
+	Proto string // scheme of client request. "http" or "https"
+	Host  string // host of client request
+
+	peer      string   // ip address of direct connection
+	trusted   bool     // peer is trusted proxy
+	chain     []string // X-Forwarded-For from trusted proxy
+	forwarded string   // Forwarded from trusted proxy
+}
+
+// Origin returns scheme and host of client request
+func (c *ClientInfo) Origin() string {
+	return fmt.Sprintf("%s://%s", c.Proto, c.Host)
+}
+
+// URL builds absolute url of path on the client origin
+func (c *ClientInfo) URL(path string) string {
+	u, err := url.Parse(path)
+	if err != nil || u.IsAbs() {
+		return path
+	}
+	return c.Origin() + singleJoiningSlash("", path)
+}
+
+// TrustedProxies sets networks of proxy whose forwarding headers are honoured
+func TrustedProxies(nets ...*net.IPNet) Option {
+	return func(rt *router) {
+		rt.trustedProxies = append(rt.trustedProxies, nets...)
+	}
+}
+
+// ParseCIDRs parses list of CIDR or ip address
+func ParseCIDRs(list []string) ([]*net.IPNet, error) {
+	nets := make([]*net.IPNet, 0, len(list))
+	for _, v := range list {
+		if !strings.Contains(v, "/") {
+			ip := net.ParseIP(v)
+			if ip == nil {
+				return nil, errors.Errorf("Invalid ip address [%s]", v)
+			}
+			bits := 8 * net.IPv6len
+			if ip.To4() != nil {
+				ip, bits = ip.To4(), 8*net.IPv4len
+			}
+			nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+			continue
+		}
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		nets = append(nets, n)
+	}
+	return nets, nil
+}
+
+// ResolveClient resolves client ip, scheme and host and sets to context.
+// Forwarding headers are honoured only when they come from trusted proxy.
+func (rt *router) ResolveClient() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ci := rt.resolveClient(r)
+			ctx := context.WithValue(r.Context(), clientInfoKey, ci)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Client returns ClientInfo of the request
+func (rt *router) Client(r *http.Request) *ClientInfo {
+	if ci, ok := r.Context().Value(clientInfoKey).(*ClientInfo); ok {
+		return ci
+	}
+	return rt.resolveClient(r)
+}
+
+func (rt *router) isTrusted(ip string) bool {
+	x := net.ParseIP(ip)
+	if x == nil {
+		return false
+	}
+	for _, v := range rt.trustedProxies {
+		if v.Contains(x) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rt *router) resolveClient(r *http.Request) *ClientInfo {
+	peer := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		peer = host
+	}
+	ci := &ClientInfo{
+		IP:    peer,
+		Proto: "http",
+		Host:  r.Host,
+		peer:  peer,
+	}
+	if r.TLS != nil {
+		ci.Proto = "https"
+	}
+	if !rt.isTrusted(peer) {
+		return ci
+	}
+	ci.trusted = true
+
+	// RFC 7239 Forwarded has priority over X-Forwarded-*
+	if fwd := r.Header.Get("Forwarded"); len(fwd) > 0 {
+		ci.forwarded = strings.Join(r.Header["Forwarded"], ", ")
+		elems := parseForwarded(ci.forwarded)
+		for i := len(elems) - 1; i >= 0; i-- {
+			e := elems[i]
+			// the hop is unknown. keep address of the last trusted hop
+			if v := e["for"]; len(v) < 1 || v == "unknown" {
+				break
+			}
+			ci.IP = e["for"]
+			if v, ok := e["proto"]; ok {
+				ci.Proto = v
+			}
+			if v, ok := e["host"]; ok {
+				ci.Host = v
+			}
+			if !rt.isTrusted(ci.IP) {
+				break
+			}
+		}
+		return ci
+	}
+
+	for _, v := range r.Header["X-Forwarded-For"] {
+		for _, x := range strings.Split(v, ",") {
+			if x = strings.TrimSpace(x); len(x) > 0 {
+				ci.chain = append(ci.chain, x)
+			}
+		}
+	}
+	for i := len(ci.chain) - 1; i >= 0; i-- {
+		ci.IP = ci.chain[i]
+		if !rt.isTrusted(ci.IP) {
+			break
+		}
+	}
+	if v := firstValue(r.Header.Get("X-Forwarded-Proto")); len(v) > 0 {
+		ci.Proto = v
+	}
+	if v := firstValue(r.Header.Get("X-Forwarded-Host")); len(v) > 0 {
+		ci.Host = v
+	}
+	return ci
+}
+
+// setForwardedHeaders writes forwarding headers to outgoing request
+func (rt *router) setForwardedHeaders(req *http.Request, ci *ClientInfo) {
+	// httputil.ReverseProxy appends peer address to X-Forwarded-For
+	req.Header.Del("X-Forwarded-For")
+	if ci.trusted && len(ci.chain) > 0 {
+		req.Header.Set("X-Forwarded-For", strings.Join(ci.chain, ", "))
+	}
+	req.Header.Set("X-Forwarded-Proto", ci.Proto)
+	req.Header.Set("X-Forwarded-Host", ci.Host)
+
+	prior := ci.forwarded
+	if ci.trusted && len(prior) < 1 && ci.IP != ci.peer {
+		prior = forwardedElement(ci.IP, ci.Host, ci.Proto)
+	}
+	proto := "http"
+	if req.TLS != nil {
+		proto = "https"
+	}
+	elem := forwardedElement(ci.peer, req.Host, proto)
+	if len(prior) > 0 {
+		elem = prior + ", " + elem
+	}
+	req.Header.Set("Forwarded", elem)
+}
+
+func forwardedElement(ip, host, proto string) string {
+	node := ip
+	if x := net.ParseIP(ip); x != nil && x.To4() == nil {
+		node = fmt.Sprintf(`"[%s]"`, ip)
+	}
+	return fmt.Sprintf("for=%s;host=%s;proto=%s", node, quoteForwarded(host), proto)
+}
+
+func quoteForwarded(s string) string {
+	if strings.ContainsAny(s, ":[]\" ,;") {
+		return fmt.Sprintf("%q", s)
+	}
+	return s
+}
+
+// parseForwarded parses RFC 7239 Forwarded header
+func parseForwarded(s string) []map[string]string {
+	var list []map[string]string
+	for _, elem := range strings.Split(s, ",") {
+		m := make(map[string]string)
+		for _, pair := range strings.Split(elem, ";") {
+			kv := strings.SplitN(strings.TrimSpace(pair), "=", 2)
+			if len(kv) != 2 {
+				continue
+			}
+			v := strings.Trim(kv[1], `"`)
+			if strings.ToLower(kv[0]) == "for" {
+				v = strings.TrimPrefix(v, "[")
+				if i := strings.LastIndex(v, "]"); i >= 0 {
+					v = v[:i]
+				} else if host, _, err := net.SplitHostPort(v); err == nil {
+					v = host
+				}
+			}
+			m[strings.ToLower(kv[0])] = v
+		}
+		if len(m) > 0 {
+			list = append(list, m)
+		}
+	}
+	return list
+}
+
+func firstValue(s string) string {
+	if i := strings.Index(s, ","); i >= 0 {
+		s = s[:i]
+	}
+	return strings.TrimSpace(s)
+}
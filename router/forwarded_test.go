@@ -0,0 +1,98 @@
+package router_test
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestForwardedHeaders(t *testing.T) {
+	trusted, err := router.ParseCIDRs([]string{"10.0.0.0/8", "192.0.2.1"})
+	checkError(t, err)
+	tp := newTestProxy(t, nil, router.TrustedProxies(trusted...))
+	defer tp.Close()
+
+	table := []struct {
+		remote  string
+		headers map[string]string
+		ip      string
+		xff     string
+		proto   string
+		host    string
+		fwd     string
+	}{
+		// direct access from client
+		{
+			remote: "198.51.100.7:50000",
+			headers: map[string]string{
+				"X-Forwarded-For":   "203.0.113.1",
+				"X-Forwarded-Proto": "https",
+				"Forwarded":         "for=203.0.113.1",
+			},
+			ip:    "198.51.100.7",
+			xff:   "198.51.100.7",
+			proto: "http",
+			host:  "example.com",
+			fwd:   "for=198.51.100.7;host=example.com;proto=http",
+		},
+		// via trusted load balancer
+		{
+			remote: "10.0.0.5:50000",
+			headers: map[string]string{
+				"X-Forwarded-For":   "203.0.113.1, 10.0.0.9",
+				"X-Forwarded-Proto": "https",
+				"X-Forwarded-Host":  "auth.example.com",
+			},
+			ip:    "203.0.113.1",
+			xff:   "203.0.113.1, 10.0.0.9, 10.0.0.5",
+			proto: "https",
+			host:  "auth.example.com",
+			fwd:   "for=203.0.113.1;host=auth.example.com;proto=https, for=10.0.0.5;host=example.com;proto=http",
+		},
+		// spoofed chain before trusted load balancer
+		{
+			remote: "192.0.2.1:50000",
+			headers: map[string]string{
+				"Forwarded": `for=198.51.100.1, for="[2001:db8::1]:4711";proto=https;host=auth.example.com`,
+			},
+			ip:    "2001:db8::1",
+			xff:   "192.0.2.1",
+			proto: "https",
+			host:  "auth.example.com",
+			fwd:   `for=198.51.100.1, for="[2001:db8::1]:4711";proto=https;host=auth.example.com, for=192.0.2.1;host=example.com;proto=http`,
+		},
+		// element without for keeps address of the trusted peer
+		{
+			remote: "10.0.0.5:50000",
+			headers: map[string]string{
+				"Forwarded": "proto=https;host=auth.example.com",
+			},
+			ip:    "10.0.0.5",
+			xff:   "10.0.0.5",
+			proto: "http",
+			host:  "example.com",
+			fwd:   "proto=https;host=auth.example.com, for=10.0.0.5;host=example.com;proto=http",
+		},
+	}
+	for _, v := range table {
+		req := httptest.NewRequest("GET", "/public/", nil)
+		req.RemoteAddr = v.remote
+		for k, x := range v.headers {
+			req.Header.Set(k, x)
+		}
+		ci := tp.rp.Client(req)
+		assert.Equal(t, v.ip, ci.IP)
+		assert.Equal(t, v.proto, ci.Proto)
+		assert.Equal(t, v.host, ci.Host)
+
+		rec := httptest.NewRecorder()
+		tp.ServeHTTP(rec, req)
+		assert.Equal(t, 200, rec.Code)
+		assert.Equal(t, v.xff, tp.got.Get("X-Forwarded-For"))
+		assert.Equal(t, v.proto, tp.got.Get("X-Forwarded-Proto"))
+		assert.Equal(t, v.host, tp.got.Get("X-Forwarded-Host"))
+		assert.Equal(t, v.fwd, tp.got.Get("Forwarded"))
+	}
+}
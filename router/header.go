@@ -0,0 +1,271 @@
+package router
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"text/template"
+	"text/template/parse"
+
+	"github.com/pkg/errors"
+)
+
+const (
+	// EncodingBase64 encodes header value by standard base64
+	EncodingBase64 = "base64"
+	// EncodingJSON encodes claim value as JSON text
+	EncodingJSON = "json"
+
+	defaultSeparator = ","
+)
+
+// AdditionalHeader is mapping rule from ID token claims to request header
+// of upstream.
+type AdditionalHeader struct {
+	// ClaimKey is path of claims. nested object and array index are
+	// separated by "." e.g. "address.country", "groups.0"
+	ClaimKey   string `json:"claim" yaml:"claim"`
+	HeaderName string `json:"header" yaml:"header"`
+	// Separator joins values when claim is array. default is ","
+	Separator string `json:"separator" yaml:"separator"`
+	// Encoding is one of "", "base64" or "json"
+	Encoding string `json:"encoding" yaml:"encoding"`
+	// Template is go text/template executed with claims.
+	// ClaimKey is ignored when Template is set.
+	// e.g. "{{.given_name}} {{.family_name}}"
+	Template string `json:"template" yaml:"template"`
+	// Default is used when claim is not found
+	Default string `json:"default" yaml:"default"`
+	// Required rejects request when claim is not found
+	Required bool `json:"required" yaml:"required"`
+}
+
+// ErrRequiredClaim is returned when required claim is not found in the token
+type ErrRequiredClaim struct {
+	HeaderName string
+	ClaimKey   string
+}
+
+func (e *ErrRequiredClaim) Error() string {
+	if len(e.ClaimKey) < 1 {
+		return fmt.Sprintf("Required claim for [%s] is not found", e.HeaderName)
+	}
+	return fmt.Sprintf("Required claim [%s] is not found", e.ClaimKey)
+}
+
+// HeaderMapper builds headers from ID token claims
+type HeaderMapper struct {
+	rules []*headerRule
+}
+
+type headerRule struct {
+	AdditionalHeader
+	path []string
+	tpl  *template.Template
+	// fields are claim paths which the template refers
+	fields [][]string
+}
+
+// NewHeaderMapper compiles mapping rules
+func NewHeaderMapper(list []AdditionalHeader) (*HeaderMapper, error) {
+	rules := make([]*headerRule, 0, len(list))
+	for i, v := range list {
+		if len(v.HeaderName) < 1 {
+			return nil, errors.Errorf("headers[%d]: header name is empty", i)
+		}
+		rule := &headerRule{AdditionalHeader: v}
+		switch v.Encoding {
+		case "", EncodingBase64, EncodingJSON:
+		default:
+			return nil, errors.Errorf("headers[%d]: unknown encoding [%s]", i, v.Encoding)
+		}
+		if len(v.Separator) < 1 {
+			rule.Separator = defaultSeparator
+		}
+		if len(v.Template) > 0 {
+			tpl, err := template.New(v.HeaderName).Option("missingkey=error").Parse(v.Template)
+			if err != nil {
+				return nil, errors.Wrapf(err, "headers[%d]: invalid template", i)
+			}
+			rule.tpl = tpl
+			rule.fields = templateFields(tpl.Tree.Root)
+		} else {
+			if len(v.ClaimKey) < 1 {
+				return nil, errors.Errorf("headers[%d]: claim or template is required", i)
+			}
+			rule.path = strings.Split(strings.TrimPrefix(v.ClaimKey, "$."), ".")
+		}
+		rules = append(rules, rule)
+	}
+	return &HeaderMapper{rules: rules}, nil
+}
+
+// Headers returns header names which is written by this mapper
+func (m *HeaderMapper) Headers() []string {
+	list := make([]string, 0, len(m.rules))
+	for _, v := range m.rules {
+		list = append(list, http.CanonicalHeaderKey(v.HeaderName))
+	}
+	return list
+}
+
+// Map builds headers from claims.
+// It returns *ErrRequiredClaim when required claim is not found.
+func (m *HeaderMapper) Map(claims map[string]interface{}) (http.Header, error) {
+	h := make(http.Header, len(m.rules))
+	for _, v := range m.rules {
+		value, ok, err := v.value(claims)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		if !ok {
+			if len(v.Default) > 0 {
+				value, ok = v.Default, true
+			} else if v.Required {
+				return nil, &ErrRequiredClaim{HeaderName: v.HeaderName, ClaimKey: v.ClaimKey}
+			}
+		}
+		if ok {
+			h.Set(v.HeaderName, value)
+		}
+	}
+	return h, nil
+}
+
+func (r *headerRule) value(claims map[string]interface{}) (string, bool, error) {
+	if r.tpl != nil {
+		for _, path := range r.fields {
+			if _, ok := lookupClaim(claims, path); !ok {
+				return "", false, nil
+			}
+		}
+		var buf bytes.Buffer
+		if err := r.tpl.Execute(&buf, claims); err != nil {
+			return "", false, errors.Wrapf(err, "header [%s]", r.HeaderName)
+		}
+		return r.encode(buf.String(), buf.String())
+	}
+	x, ok := lookupClaim(claims, r.path)
+	if !ok || x == nil {
+		return "", false, nil
+	}
+	s := formatClaim(x, r.Separator)
+	if len(s) < 1 {
+		return "", false, nil
+	}
+	return r.encode(x, s)
+}
+
+// templateFields collects fields of the claims root in the template.
+// Bodies of range and with are skipped because they change the dot.
+func templateFields(node parse.Node) [][]string {
+	var list [][]string
+	switch n := node.(type) {
+	case *parse.ListNode:
+		if n == nil {
+			return nil
+		}
+		for _, v := range n.Nodes {
+			list = append(list, templateFields(v)...)
+		}
+	case *parse.ActionNode:
+		list = templateFields(n.Pipe)
+	case *parse.PipeNode:
+		if n == nil {
+			return nil
+		}
+		for _, cmd := range n.Cmds {
+			for _, arg := range cmd.Args {
+				list = append(list, templateFields(arg)...)
+			}
+		}
+	case *parse.FieldNode:
+		list = append(list, n.Ident)
+	case *parse.VariableNode:
+		if len(n.Ident) > 1 && n.Ident[0] == "$" {
+			list = append(list, n.Ident[1:])
+		}
+	case *parse.IfNode:
+		list = append(templateFields(n.Pipe), templateFields(n.List)...)
+		list = append(list, templateFields(n.ElseList)...)
+	case *parse.RangeNode:
+		list = append(templateFields(n.Pipe), templateFields(n.ElseList)...)
+	case *parse.WithNode:
+		list = append(templateFields(n.Pipe), templateFields(n.ElseList)...)
+	case *parse.TemplateNode:
+		list = templateFields(n.Pipe)
+	}
+	return list
+}
+
+func (r *headerRule) encode(raw interface{}, s string) (string, bool, error) {
+	switch r.Encoding {
+	case EncodingBase64:
+		return base64.StdEncoding.EncodeToString([]byte(s)), true, nil
+	case EncodingJSON:
+		b, err := json.Marshal(raw)
+		if err != nil {
+			return "", false, errors.WithStack(err)
+		}
+		return string(b), true, nil
+	}
+	return s, true, nil
+}
+
+// lookupClaim follows path into nested object and array
+func lookupClaim(claims map[string]interface{}, path []string) (interface{}, bool) {
+	var x interface{} = claims
+	for _, key := range path {
+		switch v := x.(type) {
+		case map[string]interface{}:
+			next, ok := v[key]
+			if !ok {
+				return nil, false
+			}
+			x = next
+		case []interface{}:
+			i, err := strconv.Atoi(key)
+			if err != nil || i < 0 || i >= len(v) {
+				return nil, false
+			}
+			x = v[i]
+		default:
+			return nil, false
+		}
+	}
+	return x, true
+}
+
+// formatClaim converts claim value to header string
+func formatClaim(x interface{}, sep string) string {
+	switch v := x.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case []interface{}:
+		list := make([]string, 0, len(v))
+		for _, e := range v {
+			if e == nil {
+				continue
+			}
+			list = append(list, formatClaim(e, sep))
+		}
+		return strings.Join(list, sep)
+	case nil:
+		return ""
+	}
+	b, err := json.Marshal(x)
+	if err != nil {
+		return ""
+	}
+	return string(b)
+}
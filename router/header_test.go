@@ -0,0 +1,89 @@
+package router_test
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+
+	"github.com/pkg/errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestHeaderMapper(t *testing.T) {
+	var claims oidc.IDTokenClaims
+	err := json.Unmarshal([]byte(`{
+		"sub": "248289761001",
+		"preferred_username": "janedoe",
+		"given_name": "Jane",
+		"family_name": "Doe",
+		"groups": ["admin", "dev"],
+		"exp": 1311281970,
+		"email_verified": true,
+		"address": {"country": "JP"}
+	}`), &claims)
+	checkError(t, errors.WithStack(err))
+
+	table := []struct {
+		rule   router.AdditionalHeader
+		expect string
+	}{
+		{router.AdditionalHeader{ClaimKey: "preferred_username", HeaderName: "X-Username"}, "janedoe"},
+		{router.AdditionalHeader{ClaimKey: "groups", HeaderName: "X-Groups"}, "admin,dev"},
+		{router.AdditionalHeader{ClaimKey: "groups", HeaderName: "X-Groups", Separator: ";"}, "admin;dev"},
+		{router.AdditionalHeader{ClaimKey: "groups.1", HeaderName: "X-Group"}, "dev"},
+		{router.AdditionalHeader{ClaimKey: "exp", HeaderName: "X-Exp"}, "1311281970"},
+		{router.AdditionalHeader{ClaimKey: "email_verified", HeaderName: "X-Verified"}, "true"},
+		{router.AdditionalHeader{ClaimKey: "address.country", HeaderName: "X-Country"}, "JP"},
+		{router.AdditionalHeader{ClaimKey: "address", HeaderName: "X-Address"}, `{"country":"JP"}`},
+		{router.AdditionalHeader{ClaimKey: "groups", HeaderName: "X-Groups", Encoding: "json"}, `["admin","dev"]`},
+		{router.AdditionalHeader{ClaimKey: "given_name", HeaderName: "X-Name", Encoding: "base64"}, base64.StdEncoding.EncodeToString([]byte("Jane"))},
+		{router.AdditionalHeader{Template: "{{.given_name}} {{.family_name}}", HeaderName: "X-Name"}, "Jane Doe"},
+		{router.AdditionalHeader{Template: "{{.nickname}}", HeaderName: "X-Name", Default: "anonymous"}, "anonymous"},
+		{router.AdditionalHeader{Template: "{{.address.country}}-{{$.sub}}", HeaderName: "X-Region"}, "JP-248289761001"},
+		{router.AdditionalHeader{Template: "{{.address.city}}", HeaderName: "X-City", Default: "unknown"}, "unknown"},
+		{router.AdditionalHeader{Template: "{{if .given_name}}{{$.nickname}}{{end}}", HeaderName: "X-Name", Default: "anonymous"}, "anonymous"},
+		{router.AdditionalHeader{Template: "{{range .groups}}[{{.}}]{{end}}", HeaderName: "X-Groups"}, "[admin][dev]"},
+		{router.AdditionalHeader{ClaimKey: "email", HeaderName: "X-Email", Default: "none"}, "none"},
+		{router.AdditionalHeader{ClaimKey: "email", HeaderName: "X-Email"}, ""},
+	}
+	for _, v := range table {
+		hm, err := router.NewHeaderMapper([]router.AdditionalHeader{v.rule})
+		checkError(t, err)
+		h, err := hm.Map(claims.Map())
+		checkError(t, err)
+		assert.Equal(t, v.expect, h.Get(v.rule.HeaderName), v.rule)
+	}
+
+	// Required
+	hm, err := router.NewHeaderMapper([]router.AdditionalHeader{
+		{ClaimKey: "email", HeaderName: "X-Email", Required: true},
+	})
+	checkError(t, err)
+	_, err = hm.Map(claims.Map())
+	_, ok := errors.Cause(err).(*router.ErrRequiredClaim)
+	assert.True(t, ok, err)
+
+	// broken template is not treated as missing claim
+	hm, err = router.NewHeaderMapper([]router.AdditionalHeader{
+		{Template: `{{template "name"}}`, HeaderName: "X-Name", Default: "anonymous"},
+	})
+	checkError(t, err)
+	_, err = hm.Map(claims.Map())
+	assert.Error(t, err)
+	_, ok = errors.Cause(err).(*router.ErrRequiredClaim)
+	assert.False(t, ok, err)
+
+	// Invalid rules
+	invalid := []router.AdditionalHeader{
+		{ClaimKey: "sub"},
+		{HeaderName: "X-Sub"},
+		{ClaimKey: "sub", HeaderName: "X-Sub", Encoding: "hex"},
+		{Template: "{{.sub", HeaderName: "X-Sub"},
+	}
+	for _, v := range invalid {
+		_, err := router.NewHeaderMapper([]router.AdditionalHeader{v})
+		assert.Error(t, err, v)
+	}
+}
@@ -0,0 +1,105 @@
+package router
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// MeConfig is setting of session introspection endpoint
+type MeConfig struct {
+	// Claims are returned to front-end.
+	// default is sub, name, preferred_username and email
+	Claims []string `json:"claims" yaml:"claims"`
+	// IncludeTokens returns raw ID token and access token when true
+	IncludeTokens bool `json:"include_tokens" yaml:"include_tokens"`
+	// AllowOrigins enables CORS for trusted origins. e.g. "https://app.example.com"
+	AllowOrigins []string `json:"allow_origins" yaml:"allow_origins"`
+	LoginPath    string   `json:"login_path" yaml:"login_path"`
+	LogoutPath   string   `json:"logout_path" yaml:"logout_path"`
+}
+
+// MeResponse is body of session introspection
+type MeResponse struct {
+	LoggedIn    bool                   `json:"logged_in"`
+	ExpiresAt   *time.Time             `json:"expires_at,omitempty"`
+	ExpiresIn   int64                  `json:"expires_in,omitempty"`
+	User        map[string]interface{} `json:"user,omitempty"`
+	LoginURL    string                 `json:"login_url"`
+	LogoutURL   string                 `json:"logout_url"`
+	IDToken     string                 `json:"id_token,omitempty"`
+	AccessToken string                 `json:"access_token,omitempty"`
+}
+
+// Me returns login state, selected claims and expiry of current session as JSON.
+// Recommended to mount on "/.auth/me"
+func (rt *router) Me(c MeConfig) http.Handler {
+	if len(c.Claims) < 1 {
+		c.Claims = []string{"sub", "name", "preferred_username", "email"}
+	}
+	if len(c.LoginPath) < 1 {
+		c.LoginPath = "/login"
+	}
+	if len(c.LogoutPath) < 1 {
+		c.LogoutPath = "/logout"
+	}
+	origins := make(map[string]struct{}, len(c.AllowOrigins))
+	for _, v := range c.AllowOrigins {
+		origins[strings.TrimSuffix(v, "/")] = struct{}{}
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// CORS for trusted origins
+		w.Header().Add("Vary", "Origin")
+		if o := r.Header.Get("Origin"); len(o) > 0 {
+			if _, ok := origins[o]; ok {
+				w.Header().Set("Access-Control-Allow-Origin", o)
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+		}
+		if r.Method == "OPTIONS" {
+			w.Header().Set("Access-Control-Allow-Methods", "GET, OPTIONS")
+			w.Header().Set("Access-Control-Max-Age", "600")
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		ainfo, err := rt.AuthInfo(r)
+		if err != nil {
+			rt.ep.Error(w, r, err.Error(), 503)
+			return
+		}
+		ci := rt.Client(r)
+		res := MeResponse{
+			LoginURL:  ci.URL(c.LoginPath),
+			LogoutURL: ci.URL(c.LogoutPath),
+		}
+		if rt.loggedIn(ainfo) {
+			claims, err := mergedClaims(ainfo)
+			if err != nil {
+				rt.ep.Error(w, r, err.Error(), 503)
+				return
+			}
+			res.LoggedIn = true
+			expireAt := rt.expireAt(ainfo)
+			res.ExpiresAt = &expireAt
+			res.ExpiresIn = int64(time.Until(expireAt) / time.Second)
+			res.User = make(map[string]interface{}, len(c.Claims))
+			for _, k := range c.Claims {
+				if v, ok := claims[k]; ok {
+					res.User[k] = v
+				}
+			}
+			if c.IncludeTokens {
+				res.IDToken = ainfo.IDToken
+				res.AccessToken = ainfo.AccessToken
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		json.NewEncoder(w).Encode(res)
+	}
+	return http.HandlerFunc(fn)
+}
@@ -0,0 +1,66 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestMe(t *testing.T) {
+	tp := newTestProxy(t, nil)
+	defer tp.Close()
+
+	// not logged in
+	rec := tp.get("/.auth/me", nil)
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+	var res router.MeResponse
+	checkError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.False(t, res.LoggedIn)
+	assert.Equal(t, "http://example.com/login", res.LoginURL)
+	assert.Equal(t, "http://example.com/logout", res.LogoutURL)
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub":   "248289761001",
+		"email": "jane@example.com",
+		"nonce": "n-0S6_WzA2Mj",
+	}).SignedString([]byte("secret"))
+	checkError(t, err)
+	c := tp.login(t, session.AuthInfo{
+		LoggedIn: true,
+		ExpireAt: time.Now().Add(time.Hour),
+		IDToken:  token,
+		Claims:   `{"sub":"248289761001","email":"jane@example.com","nonce":"n-0S6_WzA2Mj"}`,
+	})
+
+	// selected claims without tokens
+	req := httptest.NewRequest("GET", "/.auth/me", nil)
+	req.Header.Set("Origin", "https://app.example.com")
+	req.AddCookie(c)
+	rec = httptest.NewRecorder()
+	tp.ServeHTTP(rec, req)
+	assert.Equal(t, "https://app.example.com", rec.Header().Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", rec.Header().Get("Access-Control-Allow-Credentials"))
+	res = router.MeResponse{}
+	checkError(t, json.NewDecoder(rec.Body).Decode(&res))
+	assert.True(t, res.LoggedIn)
+	assert.InDelta(t, 3600, res.ExpiresIn, 2)
+	assert.Equal(t, "248289761001", res.User["sub"])
+	assert.Equal(t, "jane@example.com", res.User["email"])
+	assert.NotContains(t, res.User, "nonce")
+	assert.Empty(t, res.IDToken)
+
+	// untrusted origin
+	req = httptest.NewRequest("OPTIONS", "/.auth/me", nil)
+	req.Header.Set("Origin", "https://evil.example.com")
+	rec = httptest.NewRecorder()
+	tp.ServeHTTP(rec, req)
+	assert.Equal(t, 204, rec.Code)
+	assert.Empty(t, rec.Header().Get("Access-Control-Allow-Origin"))
+}
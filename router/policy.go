@@ -0,0 +1,174 @@
+package router
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/oidc"
+)
+
+// SessionPolicy limits lifetime of session independent of token expiry.
+// Session expires at whichever limit comes first.
+type SessionPolicy struct {
+	// IdleTimeout expires session without access to authenticated routes. 0 disables.
+	IdleTimeout time.Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	// TouchInterval is minimum interval to save last access time.
+	// default is 1/10 of IdleTimeout
+	TouchInterval time.Duration `json:"touch_interval" yaml:"touch_interval"`
+	// AbsoluteTimeout is max lifetime from login. 0 disables.
+	// Next login after expired prompts login to the provider.
+	AbsoluteTimeout time.Duration `json:"absolute_timeout" yaml:"absolute_timeout"`
+	// MaxSessions is limit of concurrent sessions per user. 0 disables.
+	MaxSessions int `json:"max_sessions" yaml:"max_sessions"`
+	// OnLimit is "evict" to log out the oldest session or "refuse" to reject new login.
+	// default is "evict"
+	OnLimit string `json:"on_limit" yaml:"on_limit"`
+}
+
+// Action of SessionPolicy.OnLimit
+const (
+	OnLimitEvict  = "evict"
+	OnLimitRefuse = "refuse"
+)
+
+// errSessionLimit is returned when login is refused by MaxSessions
+var errSessionLimit = errors.New("Too many sessions. Please logout on other devices.")
+
+// Policy sets SessionPolicy
+func Policy(p SessionPolicy) Option {
+	return func(rt *router) {
+		if p.TouchInterval <= 0 {
+			p.TouchInterval = p.IdleTimeout / 10
+		}
+		rt.policy = p
+	}
+}
+
+// expireAt returns the earliest limit of the session
+func (rt *router) expireAt(ainfo *session.AuthInfo) time.Time {
+	exp := ainfo.ExpireAt
+	if rt.policy.IdleTimeout > 0 && !ainfo.LastAccessAt.IsZero() {
+		if t := ainfo.LastAccessAt.Add(rt.policy.IdleTimeout); t.Before(exp) {
+			exp = t
+		}
+	}
+	if rt.policy.AbsoluteTimeout > 0 && !ainfo.LoginAt.IsZero() {
+		if t := ainfo.LoginAt.Add(rt.policy.AbsoluteTimeout); t.Before(exp) {
+			exp = t
+		}
+	}
+	return exp
+}
+
+// policyExpired reports the session is over idle timeout or absolute lifetime
+func (rt *router) policyExpired(ainfo *session.AuthInfo) bool {
+	if rt.policy.IdleTimeout > 0 && !ainfo.LastAccessAt.IsZero() &&
+		time.Since(ainfo.LastAccessAt) >= rt.policy.IdleTimeout {
+		return true
+	}
+	return rt.absoluteExpired(ainfo)
+}
+
+// absoluteExpired reports the session is over absolute lifetime
+func (rt *router) absoluteExpired(ainfo *session.AuthInfo) bool {
+	return rt.policy.AbsoluteTimeout > 0 && ainfo.LoggedIn && !ainfo.LoginAt.IsZero() &&
+		time.Since(ainfo.LoginAt) >= rt.policy.AbsoluteTimeout
+}
+
+// touch updates last access time at most every TouchInterval
+func (rt *router) touch(w http.ResponseWriter, r *http.Request, ainfo *session.AuthInfo) {
+	if rt.policy.IdleTimeout <= 0 || time.Since(ainfo.LastAccessAt) < rt.policy.TouchInterval {
+		return
+	}
+	ainfo.LastAccessAt = time.Now()
+	if err := rt.astore.Save(w, r, ainfo); err != nil {
+		logrus.Warnf("Fail save last access of [%s]: %s", ainfo.Subject, err)
+	}
+}
+
+// checkAuthTime verifies auth_time satisfies max_age requested on login
+func (rt *router) checkAuthTime(ainfo *session.AuthInfo, claims *oidc.IDTokenClaims) error {
+	if ainfo.MaxAge <= 0 {
+		return nil
+	}
+	return rt.clock.ValidateAuthTime(authTimeOf(claims), time.Duration(ainfo.MaxAge)*time.Second)
+}
+
+// authTimeOf returns auth_time claim. zero when not found.
+func authTimeOf(claims *oidc.IDTokenClaims) time.Time {
+	if claims.AuthTime < 1 {
+		return time.Time{}
+	}
+	return time.Unix(claims.AuthTime, 0)
+}
+
+// RequireRecentAuth rejects session authenticated before maxAge
+// and requests max_age to the provider on next login.
+// Recommended to insert after AuthRedirect of sensitive routes
+func (rt *router) RequireRecentAuth(maxAge time.Duration) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ainfo, err := rt.AuthInfo(r)
+			if err != nil {
+				rt.ep.Error(w, r, err.Error(), 503)
+				return
+			}
+			if rt.clock.ValidateAuthTime(ainfo.AuthTime, maxAge) == nil {
+				next.ServeHTTP(w, r)
+				return
+			}
+			ainfo.MaxAge = int(maxAge / time.Second)
+			if err := rt.astore.Save(w, r, ainfo); err != nil {
+				rt.ep.Error(w, r, err.Error(), 503)
+				return
+			}
+			rt.ep.Error(w, r, "Please Login again.", 401)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// limitSessions evicts oldest sessions of the user or refuses the login
+// to keep number of sessions with new one under MaxSessions
+func (rt *router) limitSessions(r *http.Request, sub string) error {
+	if rt.policy.MaxSessions <= 0 {
+		return nil
+	}
+	list, err := rt.astore.Sessions(r.Context())
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	// current session is renewed on login
+	current := rt.astore.SessionID(r)
+	var own []session.Record
+	for _, v := range list {
+		if v.Subject == sub && v.ID != current {
+			own = append(own, v)
+		}
+	}
+	over := len(own) - rt.policy.MaxSessions + 1
+	if over <= 0 {
+		return nil
+	}
+	if rt.policy.OnLimit == OnLimitRefuse {
+		return errSessionLimit
+	}
+	// list is in order of login
+	for _, v := range own[:over] {
+		if err := rt.astore.Revoke(r.Context(), v.ID); err != nil && errors.Cause(err) != session.ErrNotFound {
+			return errors.WithStack(err)
+		}
+		rt.audit(r, logging.EventSessionRevoked, &session.AuthInfo{
+			Subject:  v.Subject,
+			Username: v.Username,
+		}, logrus.Fields{
+			"session_id": v.ID,
+			"reason":     "session_limit",
+		})
+	}
+	return nil
+}
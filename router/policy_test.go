@@ -0,0 +1,144 @@
+package router_test
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestSessionPolicy(t *testing.T) {
+	tp := newTestProxy(t, nil, router.Policy(router.SessionPolicy{
+		IdleTimeout:     time.Hour,
+		AbsoluteTimeout: time.Hour * 8,
+	}))
+	defer tp.Close()
+
+	now := time.Now()
+	table := []struct {
+		name string
+		info session.AuthInfo
+		code int
+	}{
+		{"active", session.AuthInfo{LoggedIn: true, ExpireAt: now.Add(time.Hour), LoginAt: now, LastAccessAt: now}, 200},
+		{"idle", session.AuthInfo{LoggedIn: true, ExpireAt: now.Add(time.Hour), LoginAt: now.Add(-time.Hour * 2), LastAccessAt: now.Add(-time.Hour * 2)}, 401},
+		{"absolute", session.AuthInfo{LoggedIn: true, ExpireAt: now.Add(time.Hour), LoginAt: now.Add(-time.Hour * 9), LastAccessAt: now}, 401},
+		{"token", session.AuthInfo{LoggedIn: true, ExpireAt: now.Add(-time.Minute), LoginAt: now, LastAccessAt: now}, 401},
+		{"token within leeway", session.AuthInfo{LoggedIn: true, ExpireAt: now.Add(-time.Second * 10), LoginAt: now, LastAccessAt: now}, 200},
+	}
+	for _, v := range table {
+		c := tp.login(t, v.info)
+		assert.Equal(t, v.code, tp.get("/private/a", c).Code, v.name)
+	}
+
+	// shorter leeway
+	strict := newTestProxy(t, nil, router.Leeway(time.Second))
+	defer strict.Close()
+	c := strict.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: now.Add(-time.Second * 10), LoginAt: now, LastAccessAt: now})
+	assert.Equal(t, 401, strict.get("/private/a", c).Code)
+
+	// expiry of introspection is earliest limit
+	c = tp.login(t, session.AuthInfo{
+		LoggedIn:     true,
+		ExpireAt:     now.Add(time.Hour * 2),
+		LoginAt:      now,
+		LastAccessAt: now.Add(-time.Minute * 30),
+	})
+	var res router.MeResponse
+	checkError(t, json.NewDecoder(tp.get("/.auth/me", c).Body).Decode(&res))
+	assert.InDelta(t, 1800, res.ExpiresIn, 2)
+}
+
+func TestRequireRecentAuth(t *testing.T) {
+	auth := &fakeAuth{claims: oidc.IDTokenClaims{
+		Subject:   "248289761001",
+		ExpireInt: time.Now().Add(time.Hour).Unix(),
+		AuthTime:  time.Now().Add(-time.Hour).Unix(),
+	}}
+	mux := newLoginMux(t, auth)
+	_, c := loginFlow(t, mux)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/private/a", nil), c).Code)
+	assert.Equal(t, 401, serve(mux, httptest.NewRequest("GET", "/sensitive/a", nil), c).Code)
+
+	// next login requests max_age
+	rec := serve(mux, httptest.NewRequest("GET", "/login", nil), c)
+	assert.Equal(t, 302, rec.Code)
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	checkError(t, err)
+	assert.Equal(t, "60", loc.Query().Get("max_age"))
+
+	// callback with old auth_time is rejected
+	form := url.Values{"state": {loc.Query().Get("state")}}
+	req := httptest.NewRequest("POST", "/cb", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, 401, serve(mux, req, c).Code)
+
+	// re-authenticated
+	auth.claims.AuthTime = time.Now().Unix()
+	_, c = loginFlow(t, mux)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/sensitive/a", nil), c).Code)
+}
+
+func TestRequireRecentAuthWithoutAuthTime(t *testing.T) {
+	// silent SSO login of the provider which omits auth_time
+	auth := &fakeAuth{claims: oidc.IDTokenClaims{
+		Subject:   "248289761001",
+		ExpireInt: time.Now().Add(time.Hour).Unix(),
+	}}
+	mux := newLoginMux(t, auth)
+	_, c := loginFlow(t, mux)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/private/a", nil), c).Code)
+	assert.Equal(t, 401, serve(mux, httptest.NewRequest("GET", "/sensitive/a", nil), c).Code)
+}
+
+func TestAbsoluteTimeoutPromptsLogin(t *testing.T) {
+	mux := newLoginMux(t, &fakeAuth{claims: oidc.IDTokenClaims{
+		Subject:   "248289761001",
+		ExpireInt: time.Now().Add(time.Hour).Unix(),
+	}}, router.Policy(router.SessionPolicy{AbsoluteTimeout: time.Nanosecond}))
+	_, c := loginFlow(t, mux)
+
+	rec := serve(mux, httptest.NewRequest("GET", "/login", nil), c)
+	assert.Equal(t, 302, rec.Code)
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	checkError(t, err)
+	assert.Equal(t, "login", loc.Query().Get("prompt"))
+}
+
+func TestMaxSessions(t *testing.T) {
+	claims := oidc.IDTokenClaims{
+		Subject:   "248289761001",
+		ExpireInt: time.Now().Add(time.Hour).Unix(),
+	}
+
+	// evict oldest session
+	mux := newLoginMux(t, &fakeAuth{claims: claims}, router.Policy(router.SessionPolicy{MaxSessions: 2}))
+	_, c1 := loginFlow(t, mux)
+	_, c2 := loginFlow(t, mux)
+	_, c3 := loginFlow(t, mux)
+	assert.Equal(t, 401, serve(mux, httptest.NewRequest("GET", "/private/a", nil), c1).Code)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/private/a", nil), c2).Code)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/private/a", nil), c3).Code)
+
+	// refuse new login
+	mux = newLoginMux(t, &fakeAuth{claims: claims}, router.Policy(router.SessionPolicy{
+		MaxSessions: 1,
+		OnLimit:     router.OnLimitRefuse,
+	}))
+	_, c1 = loginFlow(t, mux)
+	rec := serve(mux, httptest.NewRequest("GET", "/login", nil), nil)
+	loc, err := url.Parse(rec.Header().Get("Location"))
+	checkError(t, err)
+	form := url.Values{"state": {loc.Query().Get("state")}}
+	req := httptest.NewRequest("POST", "/cb", strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	assert.Equal(t, 403, serve(mux, req, sessionCookie(rec)).Code)
+	assert.Equal(t, 200, serve(mux, httptest.NewRequest("GET", "/private/a", nil), c1).Code)
+}
@@ -0,0 +1,58 @@
+package router
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/ratelimit"
+)
+
+// Key of RateLimitRule
+const (
+	RateLimitByIP  = "ip"
+	RateLimitBySub = "sub"
+)
+
+// RateLimitRule limits requests under the path prefix
+type RateLimitRule struct {
+	// Path is prefix of request path. First matched rule is applied.
+	Path string `json:"path" yaml:"path"`
+	// Key is "ip" or "sub". Requests without login are limited by ip when "sub".
+	Key             string `json:"key" yaml:"key"`
+	ratelimit.Limit `yaml:",inline"`
+}
+
+// RateLimit rejects requests over the rule with 429.
+// Recommended to insert after LoadSession
+func (rt *router) RateLimit(s ratelimit.Store, rules []RateLimitRule) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			for _, v := range rules {
+				if !strings.HasPrefix(r.URL.Path, v.Path) {
+					continue
+				}
+				key := v.Path + "|ip|" + rt.Client(r).IP
+				if v.Key == RateLimitBySub {
+					if ainfo, err := rt.AuthInfo(r); err == nil && rt.loggedIn(ainfo) {
+						key = v.Path + "|sub|" + ainfo.Subject
+					}
+				}
+				ok, wait, err := s.Take(r.Context(), key, v.Limit)
+				if err != nil {
+					// prefer availability when limiter store is down
+					logrus.Warnf("Fail rate limit of [%s]: %s", key, err)
+				} else if !ok {
+					w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+					rt.ep.Error(w, r, "Too many requests.", http.StatusTooManyRequests)
+					return
+				}
+				break
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
@@ -0,0 +1,60 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/ratelimit"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestRateLimit(t *testing.T) {
+	tp := newTestProxy(t, nil)
+	defer tp.Close()
+	mux := chi.NewRouter()
+	mux.Use(tp.rp.ResolveClient())
+	mux.Use(tp.rp.LoadSession())
+	mux.Use(tp.rp.RateLimit(ratelimit.NewMemoryStore(), []router.RateLimitRule{
+		{Path: "/login", Key: router.RateLimitByIP, Limit: ratelimit.Limit{Requests: 2, Per: time.Minute}},
+		{Path: "/app", Key: router.RateLimitBySub, Limit: ratelimit.Limit{Requests: 1, Per: time.Minute}},
+	}))
+	mux.HandleFunc("/*", func(w http.ResponseWriter, r *http.Request) {})
+
+	get := func(path, ip string, c *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.RemoteAddr = ip + ":12345"
+		if c != nil {
+			req.AddCookie(c)
+		}
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, req)
+		return rec
+	}
+
+	// by ip
+	assert.Equal(t, 200, get("/login", "192.0.2.1", nil).Code)
+	assert.Equal(t, 200, get("/login", "192.0.2.1", nil).Code)
+	rec := get("/login", "192.0.2.1", nil)
+	assert.Equal(t, 429, rec.Code)
+	assert.Equal(t, "30", rec.Header().Get("Retry-After"))
+	assert.Equal(t, 200, get("/login", "192.0.2.2", nil).Code)
+
+	// by sub over ip
+	exp := time.Now().Add(time.Hour)
+	jane1 := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: exp, Subject: "jane"})
+	jane2 := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: exp, Subject: "jane"})
+	john := tp.login(t, session.AuthInfo{LoggedIn: true, ExpireAt: exp, Subject: "john"})
+	assert.Equal(t, 200, get("/app/a", "192.0.2.1", jane1).Code)
+	assert.Equal(t, 429, get("/app/a", "192.0.2.2", jane2).Code)
+	assert.Equal(t, 200, get("/app/a", "192.0.2.1", john).Code)
+
+	// not limited path
+	for i := 0; i < 3; i++ {
+		assert.Equal(t, 200, get("/public/a", "192.0.2.1", nil).Code)
+	}
+}
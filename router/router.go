@@ -1,29 +1,48 @@
 package router
 
 import (
+	"context"
 	"fmt"
+	"net"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
 	"regexp"
+	"strconv"
 	"strings"
 	"time"
 
-	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi/middleware"
 	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
 	"github.com/uzuna/go-authproxy/errorpage"
 	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/logging"
+	"github.com/uzuna/go-authproxy/metrics"
 	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/ratelimit"
+	"github.com/uzuna/go-authproxy/tracing"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type RouteProvider interface {
 	LoadSession() func(next http.Handler) http.Handler
+	StripHeaders() func(next http.Handler) http.Handler
+	ResolveClient() func(next http.Handler) http.Handler
 	AuthRedirect() func(next http.Handler) http.Handler
+	RateLimit(s ratelimit.Store, rules []RateLimitRule) func(next http.Handler) http.Handler
+	RequireRecentAuth(maxAge time.Duration) func(next http.Handler) http.Handler
+	CSRF(c CSRFConfig) (func(next http.Handler) http.Handler, error)
 	Authenticate() http.Handler
 	Login(ex ExpectRedirectProp) http.Handler
-	ReverseProxy(target *url.URL, list []AdditionalHeader) http.Handler
+	Logout() http.Handler
+	Me(c MeConfig) http.Handler
+	SessionAdmin(v oidc.TokenVerifier, c AdminConfig) http.Handler
+	ReverseProxy(target *url.URL, list []AdditionalHeader) (http.Handler, error)
 
 	AuthInfo(r *http.Request) (*session.AuthInfo, error)
+	Claims(r *http.Request) (map[string]interface{}, error)
+	Client(r *http.Request) *ClientInfo
 }
 
 func ReferrerMatch(re *regexp.Regexp) ExpectRedirectProp {
@@ -46,36 +65,132 @@ type ExpectRedirectProp interface {
 	Referrer(string) bool
 }
 
+type contextKey struct {
+	name string
+}
+
+var (
+	// proxyHeaderKey holds mapped headers for director
+	proxyHeaderKey = &contextKey{"proxyheader"}
+)
+
+// Option is optional setting of RouteProvider
+type Option func(*router)
+
+// IdentityHeaders sets headers which are owned by the proxy.
+// These are removed from every incoming request.
+func IdentityHeaders(names ...string) Option {
+	return func(rt *router) {
+		for _, v := range names {
+			rt.identityHeaders = append(rt.identityHeaders, http.CanonicalHeaderKey(v))
+		}
+	}
+}
+
+// CallbackPath sets path of Authenticate.
+// redirect_uri is built from the path and the resolved client origin.
+func CallbackPath(path string) Option {
+	return func(rt *router) {
+		rt.callbackPath = path
+	}
+}
+
+// Audit sets Auditor which records security events
+func Audit(a *logging.Auditor) Option {
+	return func(rt *router) {
+		rt.auditor = a
+	}
+}
+
+// Leeway sets allowed clock difference of token expiry and auth_time.
+// default is oidc.DefaultLeeway
+func Leeway(d time.Duration) Option {
+	return func(rt *router) {
+		rt.clock = oidc.NewTimeValidator(d)
+	}
+}
+
 // New creates RouteProvider
-func New(auth oidc.Authenticator, astore session.AuthStore, ep *errorpage.ErrorPages, aiKey interface{}) RouteProvider {
-	return &router{
-		auth:        auth,
-		astore:      astore,
-		ep:          ep,
-		authinfoKey: aiKey,
+func New(auth oidc.Authenticator, astore session.AuthStore, ep *errorpage.ErrorPages, aiKey interface{}, opts ...Option) RouteProvider {
+	rt := &router{
+		auth:            auth,
+		astore:          astore,
+		ep:              ep,
+		authinfoKey:     aiKey,
+		identityHeaders: []string{"Authorization"},
+		clock:           oidc.NewTimeValidator(oidc.DefaultLeeway),
 	}
+	for _, opt := range opts {
+		opt(rt)
+	}
+	return rt
 }
 
 type router struct {
-	auth        oidc.Authenticator
-	astore      session.AuthStore
-	ep          *errorpage.ErrorPages
-	authinfoKey interface{}
+	auth            oidc.Authenticator
+	astore          session.AuthStore
+	ep              *errorpage.ErrorPages
+	authinfoKey     interface{}
+	identityHeaders []string
+	trustedProxies  []*net.IPNet
+	callbackPath    string
+	callbackOrigins []string
+	auditor         *logging.Auditor
+	userinfo        *oidc.UserInfoClient
+	userinfoRefresh time.Duration
+	policy          SessionPolicy
+	bearer          oidc.TokenVerifier
+	clock           *oidc.TimeValidator
 }
 
+// LoadSession loads authinfo from session store and sets to context
 func (rt *router) LoadSession() func(next http.Handler) http.Handler {
-	return rt.astore.Handler()
+	load := rt.astore.Handler()
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			parent := trace.SpanFromContext(r.Context())
+			ctx, span := tracing.Start(r.Context(), "LoadSession")
+			defer span.End()
+			h := load(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				span.End()
+				r, ok := rt.authenticateBearer(w, r)
+				if !ok {
+					return
+				}
+				if ainfo, err := rt.AuthInfo(r); err == nil && ainfo.LoggedIn {
+					logging.SetUser(r.Context(), ainfo.Subject, ainfo.Username)
+				}
+				// following spans are not children of LoadSession
+				next.ServeHTTP(w, r.WithContext(trace.ContextWithSpan(r.Context(), parent)))
+			}))
+			h.ServeHTTP(w, r.WithContext(ctx))
+		}
+		return http.HandlerFunc(fn)
+	}
 }
 
 // Authenticate recieve authenticate responce
 // Recommended to mount on "/cb"
 func (rt *router) Authenticate() http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), "Authenticate")
+		defer span.End()
+		r = r.WithContext(ctx)
+
+		metrics.ObserveLoginAttempt()
+
+		// form_post must come from the provider
+		if err := rt.checkCallbackOrigin(r); err != nil {
+			rt.loginFailure(r, oidc.ReasonRequest, err)
+			rt.ep.Error(w, r, err.Error(), 403)
+			return
+		}
 
 		// Parse body and validate key
 		ares, err := rt.auth.Authenticate(r)
 		if err != nil {
-			rt.ep.Error(w, r, err.Error(), 401)
+			rt.loginFailure(r, oidc.ErrorReason(err), err)
+			rt.ep.Error(w, r, authErrorMessage(err), 401)
 			return
 		}
 
@@ -88,10 +203,26 @@ func (rt *router) Authenticate() http.Handler {
 
 		if ares.State != ainfo.AuthenticationState {
 			err = errors.Errorf("Unmatch state")
+			rt.loginFailure(r, oidc.ReasonState, err)
 			rt.ep.Error(w, r, err.Error(), 401)
 			return
 		}
 
+		if err := rt.checkAuthTime(ainfo, ares.Claims); err != nil {
+			rt.loginFailure(r, oidc.ErrorReason(err), err)
+			rt.ep.Error(w, r, authErrorMessage(err), 401)
+			return
+		}
+
+		if err := rt.limitSessions(r, ares.Claims.Subject); err == errSessionLimit {
+			rt.loginFailure(r, oidc.ReasonSessionLimit, err)
+			rt.ep.Error(w, r, err.Error(), 403)
+			return
+		} else if err != nil {
+			rt.ep.Error(w, r, err.Error(), 503)
+			return
+		}
+
 		// Redirect to referrer
 		redirectPath := "/"
 		if len(ainfo.LoginReferer) > 0 {
@@ -101,16 +232,51 @@ func (rt *router) Authenticate() http.Handler {
 		ainfo.IDToken = ares.IDToken
 		ainfo.ExpireAt = ares.Claims.Expire()
 		ainfo.LoggedIn = true
+		ainfo.Subject = ares.Claims.Subject
+		claims := ares.Claims.Map()
+		if ainfo.Claims, err = encodeClaims(claims); err != nil {
+			rt.ep.Error(w, r, err.Error(), 500)
+			return
+		}
+		ainfo.Username = usernameOfClaims(claims)
+		ainfo.AccessToken = ares.AccessToken
+		ainfo.UserInfo = ""
+		ainfo.UserInfoAt = time.Time{}
+		ainfo.LoginAt = time.Now()
+		ainfo.LastAccessAt = ainfo.LoginAt
+		// zero when the provider omits auth_time. RequireRecentAuth prompts login with max_age
+		ainfo.AuthTime = authTimeOf(ares.Claims)
+		ainfo.MaxAge = 0
+		ainfo.RemoteIP = rt.Client(r).IP
+		ainfo.UserAgent = r.UserAgent()
 
-		// Aave auth information
-		err = rt.astore.Save(w, r, ainfo)
+		// Enrich claims by userinfo
+		if rt.userinfo != nil && len(ares.AccessToken) > 0 {
+			err = rt.fetchUserInfo(r, ainfo)
+			if oidc.ErrorReason(err) == oidc.ReasonUserInfo {
+				rt.loginFailure(r, oidc.ReasonUserInfo, err)
+				rt.ep.Error(w, r, err.Error(), 401)
+				return
+			} else if err != nil {
+				logrus.Warnf("Fail fetch userinfo of [%s]: %s", ainfo.Subject, err)
+			}
+		}
+
+		// Save auth information to new session against session fixation
+		_, sspan := tracing.Start(ctx, "SessionSave")
+		err = rt.astore.Renew(w, r, ainfo)
+		tracing.End(sspan, err)
 		if err != nil {
+			rt.loginFailure(r, oidc.ReasonUnknown, err)
 			rt.ep.Error(w, r, err.Error(), 503)
 			return
 		}
+		metrics.ObserveLogin(true, "")
+		logging.SetUser(r.Context(), ainfo.Subject, ainfo.Username)
+		rt.audit(r, logging.EventLoginSuccess, ainfo, nil)
 
 		// Return to Top
-		w.Header().Set("Location", redirectPath)
+		w.Header().Set("Location", rt.Client(r).URL(redirectPath))
 		w.WriteHeader(http.StatusSeeOther)
 	}
 	return http.HandlerFunc(fn)
@@ -120,6 +286,10 @@ func (rt *router) Authenticate() http.Handler {
 // Recommended to mount on "/login"
 func (rt *router) Login(ex ExpectRedirectProp) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		ctx, span := tracing.Start(r.Context(), "Login")
+		defer span.End()
+		r = r.WithContext(ctx)
+
 		// Check authinfo
 		ainfo, err := rt.AuthInfo(r)
 		if err != nil {
@@ -127,7 +297,7 @@ func (rt *router) Login(ex ExpectRedirectProp) http.Handler {
 			return
 		}
 		// I loggedin and not expired return home
-		if ainfo.LoggedIn && time.Since(ainfo.ExpireAt) < time.Duration(0) {
+		if rt.loggedIn(ainfo) && ainfo.MaxAge <= 0 {
 			w.Header().Set("Location", "/")
 			w.WriteHeader(http.StatusSeeOther)
 			return
@@ -142,9 +312,19 @@ func (rt *router) Login(ex ExpectRedirectProp) http.Handler {
 		if ex.Referrer(referrer) {
 			ainfo.LoginReferer = referrer
 		}
-		authpath, err := rt.auth.AuthURL(state,
+		opts := []oidc.URLOptionalParameter{
 			oidc.SetURLParam("response_mode", "form_post"),
-		)
+		}
+		if ainfo.MaxAge > 0 {
+			opts = append(opts, oidc.SetURLParam("max_age", strconv.Itoa(ainfo.MaxAge)))
+		} else if rt.absoluteExpired(ainfo) {
+			// force login to the provider over its own session
+			opts = append(opts, oidc.SetURLParam("prompt", "login"))
+		}
+		if len(rt.callbackPath) > 0 {
+			opts = append(opts, oidc.SetURLParam("redirect_uri", rt.Client(r).URL(rt.callbackPath)))
+		}
+		authpath, err := rt.auth.AuthURL(state, opts...)
 		if err != nil {
 			rt.ep.Error(w, r, err.Error(), 503)
 			return
@@ -161,6 +341,35 @@ func (rt *router) Login(ex ExpectRedirectProp) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// Logout clears authinfo of the session
+// Recommended to mount on POST "/logout" with CSRF
+func (rt *router) Logout() http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		// GET is sent by cross-site <img> or link
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			rt.ep.Error(w, r, "Logout requires POST", http.StatusMethodNotAllowed)
+			return
+		}
+		ainfo, err := rt.AuthInfo(r)
+		if err != nil {
+			rt.ep.Error(w, r, err.Error(), 503)
+			return
+		}
+		if ainfo.LoggedIn {
+			rt.audit(r, logging.EventLogout, ainfo, nil)
+		}
+		err = rt.astore.Renew(w, r, &session.AuthInfo{})
+		if err != nil {
+			rt.ep.Error(w, r, err.Error(), 503)
+			return
+		}
+		w.Header().Set("Location", "/")
+		w.WriteHeader(http.StatusSeeOther)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // AuthRedirect rejects unauthenticated access and prompt login
 // Recommended to insert at the beginning of the certification route
 func (rt *router) AuthRedirect() func(next http.Handler) http.Handler {
@@ -173,16 +382,23 @@ func (rt *router) AuthRedirect() func(next http.Handler) http.Handler {
 			}
 			// Show Login page when not loggedin
 			// 301だとRefererが取れないため401ページを中継する
-			if !ainfo.LoggedIn || time.Since(ainfo.ExpireAt) > time.Second {
+			if !rt.loggedIn(ainfo) {
 				rt.ep.Error(w, r, "Please Login.", 401)
 				return
 			}
+			rt.touch(w, r, ainfo)
+			rt.refreshUserInfo(w, r, ainfo)
 			next.ServeHTTP(w, r)
 		}
 		return http.HandlerFunc(fn)
 	}
 }
 
+// loggedIn reports the session is logged in and not expired
+func (rt *router) loggedIn(ainfo *session.AuthInfo) bool {
+	return ainfo.LoggedIn && !rt.clock.Expired(ainfo.ExpireAt) && !rt.policyExpired(ainfo)
+}
+
 func (rt *router) AuthInfo(r *http.Request) (*session.AuthInfo, error) {
 	ainfo, ok := r.Context().Value(rt.authinfoKey).(*session.AuthInfo)
 	if !ok {
@@ -191,11 +407,17 @@ func (rt *router) AuthInfo(r *http.Request) (*session.AuthInfo, error) {
 	return ainfo, nil
 }
 
-type AdditionalHeader struct {
-	ClaimKey, HeaderName string
-}
+// ReverseProxy generates handler of proxy to target with Authorization header
+// and additional headers mapped from ID token claims.
+// It rejects with 403 when required claim is not found.
+func (rt *router) ReverseProxy(target *url.URL, list []AdditionalHeader) (http.Handler, error) {
+	hm, err := NewHeaderMapper(list)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	mapped := hm.Headers()
 
-func (rt *router) ReverseProxy(target *url.URL, list []AdditionalHeader) http.Handler {
 	// copy from /src/net/http/httputil/reverseproxy
 	targetQuery := target.RawQuery
 	director := func(req *http.Request) {
@@ -211,29 +433,61 @@ func (rt *router) ReverseProxy(target *url.URL, list []AdditionalHeader) http.Ha
 			req.Header.Set("User-Agent", "")
 		}
 
+		// Remove identity headers and session cookie of the proxy
+		for _, v := range rt.identityHeaders {
+			req.Header.Del(v)
+		}
+		for _, v := range mapped {
+			req.Header.Del(v)
+		}
+		removeCookie(req, rt.astore.Name())
+		rt.setForwardedHeaders(req, rt.Client(req))
+		if id := middleware.GetReqID(req.Context()); len(id) > 0 {
+			req.Header.Set("X-Request-Id", id)
+		}
+
 		// Add Authorization header
 		ainfo, err := rt.AuthInfo(req)
-		if err != nil {
+		if err != nil || len(ainfo.IDToken) < 1 {
 			return
 		}
 		req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", ainfo.IDToken))
 
 		// additional mapping
-		if len(list) > 0 {
-			var claims jwt.MapClaims
-			p := &jwt.Parser{}
-			p.ParseUnverified(ainfo.IDToken, &claims)
-			for _, v := range list {
-				if x, ok := claims[v.ClaimKey]; ok {
-					switch vv := x.(type) {
-					case string:
-						req.Header.Set(v.HeaderName, vv)
-					}
+		if h, ok := req.Context().Value(proxyHeaderKey).(http.Header); ok {
+			for k, v := range h {
+				req.Header[k] = v
+			}
+		}
+	}
+	proxy := &httputil.ReverseProxy{
+		Director:  director,
+		Transport: tracing.Transport(nil),
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		logging.SetUpstream(r.Context(), target.Host)
+		ainfo, err := rt.AuthInfo(r)
+		if err == nil && len(ainfo.IDToken) > 0 && len(list) > 0 {
+			claims, err := mergedClaims(ainfo)
+			var h http.Header
+			if err == nil {
+				h, err = hm.Map(claims)
+			}
+			if err != nil {
+				if _, ok := errors.Cause(err).(*ErrRequiredClaim); ok {
+					rt.audit(r, logging.EventAuthorizationDenied, ainfo, logrus.Fields{"reason": err.Error()})
+					rt.ep.Error(w, r, err.Error(), 403)
+					return
 				}
+				rt.ep.Error(w, r, err.Error(), 503)
+				return
 			}
+			r = r.WithContext(context.WithValue(r.Context(), proxyHeaderKey, h))
 		}
+		proxy.ServeHTTP(w, r)
 	}
-	return &httputil.ReverseProxy{Director: director}
+	return metrics.InstrumentProxy(target.Host, http.HandlerFunc(fn)), nil
 }
 
 func singleJoiningSlash(a, b string) string {
@@ -0,0 +1,99 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/go-chi/chi"
+	"github.com/quasoft/memstore"
+	"github.com/uzuna/go-authproxy/errorpage"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+type contextKey struct {
+	Name string
+}
+
+// testProxy is proxy route to upstream which records request headers
+type testProxy struct {
+	*chi.Mux
+	rp       router.RouteProvider
+	as       session.AuthStore
+	upstream *httptest.Server
+	got      http.Header
+	saveInfo session.AuthInfo
+}
+
+func newTestProxy(t *testing.T, list []router.AdditionalHeader, opts ...router.Option) *testProxy {
+	tp := &testProxy{}
+	tp.upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tp.got = r.Header
+	}))
+
+	store := memstore.NewMemStore([]byte("authkey123"))
+	aikey := &contextKey{"authinfo"}
+	tp.as = session.NewAuthStore(store, "demo", aikey)
+	ep, err := errorpage.NewErrorPages()
+	checkError(t, err)
+	tp.rp = router.New(nil, tp.as, ep, aikey, opts...)
+
+	u, err := url.Parse(tp.upstream.URL)
+	checkError(t, err)
+	rph, err := tp.rp.ReverseProxy(u, list)
+	checkError(t, err)
+
+	tp.Mux = chi.NewRouter()
+	tp.Use(tp.rp.ResolveClient())
+	tp.Use(tp.rp.StripHeaders())
+	tp.Use(tp.rp.LoadSession())
+	tp.Handle("/public/*", rph)
+	tp.Route("/private", func(r chi.Router) {
+		r.Use(tp.rp.AuthRedirect())
+		r.Handle("/*", rph)
+	})
+	tp.Handle("/.auth/me", tp.rp.Me(router.MeConfig{
+		AllowOrigins: []string{"https://app.example.com"},
+	}))
+	tp.Get("/save", func(w http.ResponseWriter, r *http.Request) {
+		info := tp.saveInfo
+		tp.as.Save(w, r, &info)
+	})
+	return tp
+}
+
+// login saves authinfo to new session and returns the cookie
+func (tp *testProxy) login(t *testing.T, info session.AuthInfo) *http.Cookie {
+	tp.saveInfo = info
+	rec := httptest.NewRecorder()
+	tp.ServeHTTP(rec, httptest.NewRequest("GET", "/save", nil))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("session cookie is not issued")
+	}
+	return cookies[0]
+}
+
+// get requests path with cookie
+func (tp *testProxy) get(path string, c *http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("GET", path, nil)
+	if c != nil {
+		req.AddCookie(c)
+	}
+	rec := httptest.NewRecorder()
+	tp.ServeHTTP(rec, req)
+	return rec
+}
+
+func (tp *testProxy) Close() {
+	tp.upstream.Close()
+}
+
+func checkError(t *testing.T, err error) {
+	if err != nil {
+		t.Logf("%+v", err)
+		t.FailNow()
+	}
+}
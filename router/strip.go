@@ -0,0 +1,44 @@
+package router
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// StripHeaders removes client-supplied identity headers.
+// Recommended to insert at the beginning of all routes include public.
+func (rt *router) StripHeaders() func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			// keep bearer token for LoadSession before removing Authorization
+			if token := bearerToken(r.Header); rt.bearer != nil && len(token) > 0 {
+				r = r.WithContext(context.WithValue(r.Context(), bearerTokenKey, token))
+			}
+			for _, v := range rt.identityHeaders {
+				r.Header.Del(v)
+			}
+			next.ServeHTTP(w, r)
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// removeCookie removes named cookie from Cookie header
+func removeCookie(r *http.Request, name string) {
+	cookies := r.Cookies()
+	if len(cookies) < 1 {
+		return
+	}
+	list := make([]string, 0, len(cookies))
+	for _, v := range cookies {
+		if v.Name == name {
+			continue
+		}
+		list = append(list, v.String())
+	}
+	r.Header.Del("Cookie")
+	if len(list) > 0 {
+		r.Header.Set("Cookie", strings.Join(list, "; "))
+	}
+}
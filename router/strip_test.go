@@ -0,0 +1,37 @@
+package router_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestStripHeaders(t *testing.T) {
+	tp := newTestProxy(t, []router.AdditionalHeader{
+		{ClaimKey: "preferred_username", HeaderName: "X-Username"},
+	}, router.IdentityHeaders("X-Roles"))
+	defer tp.Close()
+
+	c := tp.login(t, session.AuthInfo{})
+
+	req := httptest.NewRequest("GET", "/public/index.html", nil)
+	req.Header.Set("Authorization", "Bearer spoofed")
+	req.Header.Set("X-Username", "admin")
+	req.Header.Set("X-Roles", "admin")
+	req.Header.Set("X-Custom", "keep")
+	req.AddCookie(c)
+	req.AddCookie(&http.Cookie{Name: "app", Value: "keep"})
+	rec := httptest.NewRecorder()
+	tp.ServeHTTP(rec, req)
+
+	assert.Equal(t, 200, rec.Code)
+	assert.Empty(t, tp.got.Get("Authorization"))
+	assert.Empty(t, tp.got.Get("X-Username"))
+	assert.Empty(t, tp.got.Get("X-Roles"))
+	assert.Equal(t, "keep", tp.got.Get("X-Custom"))
+	assert.Equal(t, "app=keep", tp.got.Get("Cookie"))
+}
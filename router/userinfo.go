@@ -0,0 +1,129 @@
+package router
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/sirupsen/logrus"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/tracing"
+)
+
+// protocolClaims are owned by ID token and not overwritten by userinfo
+var protocolClaims = map[string]struct{}{
+	"iss": {}, "sub": {}, "aud": {}, "exp": {}, "iat": {}, "nbf": {},
+	"nonce": {}, "auth_time": {}, "azp": {}, "at_hash": {}, "c_hash": {},
+}
+
+// UserInfo enriches claims of the session by userinfo endpoint.
+// The claims are refreshed on authenticated route after refresh interval.
+func UserInfo(c *oidc.UserInfoClient, refresh time.Duration) Option {
+	return func(rt *router) {
+		rt.userinfo = c
+		rt.userinfoRefresh = refresh
+	}
+}
+
+// Claims returns claims of ID token merged with userinfo
+func (rt *router) Claims(r *http.Request) (map[string]interface{}, error) {
+	ainfo, err := rt.AuthInfo(r)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return mergedClaims(ainfo)
+}
+
+// encodeClaims encodes verified claims to store in session
+func encodeClaims(claims map[string]interface{}) (string, error) {
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return "", errors.WithStack(err)
+	}
+	return string(b), nil
+}
+
+func decodeClaims(s string) (map[string]interface{}, error) {
+	var claims map[string]interface{}
+	dec := json.NewDecoder(bytes.NewBufferString(s))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return claims, nil
+}
+
+func mergedClaims(ainfo *session.AuthInfo) (map[string]interface{}, error) {
+	claims := map[string]interface{}{}
+	if len(ainfo.Claims) > 0 {
+		c, err := decodeClaims(ainfo.Claims)
+		if err != nil {
+			return nil, err
+		}
+		claims = c
+	}
+	if len(ainfo.UserInfo) > 0 {
+		ui, err := decodeClaims(ainfo.UserInfo)
+		if err != nil {
+			return nil, err
+		}
+		for k, v := range ui {
+			if _, ok := protocolClaims[k]; ok {
+				continue
+			}
+			claims[k] = v
+		}
+	}
+	return claims, nil
+}
+
+// fetchUserInfo requests userinfo and sets to authinfo
+func (rt *router) fetchUserInfo(r *http.Request, ainfo *session.AuthInfo) error {
+	ctx, span := tracing.Start(r.Context(), "FetchUserInfo")
+	claims, err := rt.userinfo.Fetch(ctx, ainfo.AccessToken, ainfo.Subject)
+	tracing.End(span, err)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	b, err := json.Marshal(claims)
+	if err != nil {
+		return errors.WithStack(err)
+	}
+	ainfo.UserInfo = string(b)
+	ainfo.UserInfoAt = time.Now()
+	if merged, err := mergedClaims(ainfo); err == nil {
+		if name := usernameOfClaims(merged); len(name) > 0 {
+			ainfo.Username = name
+		}
+	}
+	return nil
+}
+
+// refreshUserInfo refetches userinfo when it is older than refresh interval.
+// Old claims are kept when failed.
+func (rt *router) refreshUserInfo(w http.ResponseWriter, r *http.Request, ainfo *session.AuthInfo) {
+	if rt.userinfo == nil || rt.userinfoRefresh <= 0 || len(ainfo.AccessToken) < 1 {
+		return
+	}
+	if time.Since(ainfo.UserInfoAt) < rt.userinfoRefresh {
+		return
+	}
+	prev := ainfo.UserInfo
+	err := rt.fetchUserInfo(r, ainfo)
+	if err != nil {
+		// prevent retry on every request
+		ainfo.UserInfoAt = time.Now()
+		logrus.Warnf("Fail refresh userinfo of [%s]: %s", ainfo.Subject, err)
+	}
+	save := rt.astore.Save
+	if ainfo.UserInfo != prev {
+		// claims like groups are changed
+		save = rt.astore.Renew
+	}
+	if err := save(w, r, ainfo); err != nil {
+		logrus.Warnf("Fail save userinfo of [%s]: %s", ainfo.Subject, err)
+	}
+}
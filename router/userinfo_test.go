@@ -0,0 +1,102 @@
+package router_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+func TestUserInfo(t *testing.T) {
+	email := "jane@example.com"
+	provider := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer access" {
+			w.WriteHeader(401)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		w.Write([]byte(`{"sub":"248289761001","email":"` + email + `","groups":["admin","dev"]}`))
+	}))
+	defer provider.Close()
+	uc := oidc.NewUserInfoClient(provider.URL)
+
+	tp := newTestProxy(t, []router.AdditionalHeader{
+		{ClaimKey: "sub", HeaderName: "X-Sub"},
+		{ClaimKey: "email", HeaderName: "X-Email", Required: true},
+		{ClaimKey: "groups", HeaderName: "X-Groups"},
+	}, router.UserInfo(uc, time.Minute))
+	defer tp.Close()
+
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"sub": "248289761001",
+	}).SignedString([]byte("secret"))
+	checkError(t, err)
+
+	// ID token has not email
+	info := session.AuthInfo{
+		LoggedIn:    true,
+		ExpireAt:    time.Now().Add(time.Hour),
+		IDToken:     token,
+		Claims:      `{"sub":"248289761001"}`,
+		Subject:     "248289761001",
+		AccessToken: "access",
+		UserInfoAt:  time.Now(),
+	}
+	rec := tp.get("/private/", tp.login(t, info))
+	assert.Equal(t, 403, rec.Code)
+
+	// claims of userinfo are merged
+	info.UserInfo = `{"sub":"spoofed","email":"jane@example.com"}`
+	rec = tp.get("/private/", tp.login(t, info))
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "248289761001", tp.got.Get("X-Sub"))
+	assert.Equal(t, "jane@example.com", tp.got.Get("X-Email"))
+	assert.Empty(t, tp.got.Get("X-Groups"))
+
+	// refreshed after interval
+	email = "jane.doe@example.com"
+	info.UserInfoAt = time.Now().Add(-time.Hour)
+	rec = tp.get("/private/", tp.login(t, info))
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "jane.doe@example.com", tp.got.Get("X-Email"))
+	assert.Equal(t, "admin,dev", tp.got.Get("X-Groups"))
+
+	// sub must match
+	_, err = uc.Fetch(context.Background(), "access", "other")
+	assert.Equal(t, oidc.ReasonUserInfo, oidc.ErrorReason(err))
+}
+
+func TestSessionClaims(t *testing.T) {
+	tp := newTestProxy(t, []router.AdditionalHeader{
+		{ClaimKey: "sub", HeaderName: "X-Sub"},
+		{ClaimKey: "tenant", HeaderName: "X-Tenant", Required: true},
+		{ClaimKey: "amr", HeaderName: "X-AMR"},
+	})
+	defer tp.Close()
+
+	// headers are mapped from verified claims without parsing the token
+	info := session.AuthInfo{
+		LoggedIn: true,
+		ExpireAt: time.Now().Add(time.Hour),
+		IDToken:  "header.payload.signature",
+		Subject:  "248289761001",
+		Claims:   `{"sub":"248289761001","aud":["api","client"],"azp":"client","amr":["pwd","otp"],"tenant":"t1"}`,
+	}
+	rec := tp.get("/private/", tp.login(t, info))
+	assert.Equal(t, 200, rec.Code)
+	assert.Equal(t, "248289761001", tp.got.Get("X-Sub"))
+	assert.Equal(t, "t1", tp.got.Get("X-Tenant"))
+	assert.Equal(t, "pwd,otp", tp.got.Get("X-AMR"))
+
+	// token is never parsed without verified claims
+	info.IDToken, info.Claims = "eyJhbGciOiJub25lIn0.eyJ0ZW5hbnQiOiJ0MSJ9.", ""
+	rec = tp.get("/private/", tp.login(t, info))
+	assert.Equal(t, 403, rec.Code)
+}
@@ -0,0 +1,277 @@
+// Package routertest runs the proxy with mock IdP and echo upstream for end-to-end tests.
+// Teams which embed router package can test their own stack by Config.Build.
+package routertest
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/cookiejar"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/go-chi/chi"
+	"github.com/pkg/errors"
+	"github.com/quasoft/memstore"
+	"github.com/uzuna/go-authproxy/errorpage"
+	"github.com/uzuna/go-authproxy/internal/session"
+	"github.com/uzuna/go-authproxy/oidc"
+	"github.com/uzuna/go-authproxy/oidctest"
+	"github.com/uzuna/go-authproxy/router"
+)
+
+// Env is environment to build the proxy
+type Env struct {
+	// OIDC is config of the provider. redirect_url is "/cb"
+	OIDC oidc.Config
+	// Upstream is URL of echo upstream
+	Upstream *url.URL
+}
+
+// Config is setting of Harness
+type Config struct {
+	// Provider is setting of mock IdP
+	Provider oidctest.Config
+	// Build builds the proxy. Default builds standard stack of router package
+	// which mounts "/cb", "/login", "/logout", "/.auth/me", "/public/*" and
+	// authenticated "/*".
+	Build func(e Env) (http.Handler, error)
+	// Headers and Options are used by default Build
+	Headers []router.AdditionalHeader
+	Options []router.Option
+}
+
+// Harness is the proxy between mock IdP and echo upstream
+type Harness struct {
+	IdP      *oidctest.Server
+	Upstream *httptest.Server
+	Proxy    *httptest.Server
+	// Client is browser-like client with cookie jar.
+	// It does not follow redirects to inspect each hop.
+	Client *http.Client
+}
+
+// Echo is request which upstream received
+type Echo struct {
+	Method string      `json:"method"`
+	Path   string      `json:"path"`
+	Header http.Header `json:"header"`
+}
+
+// New starts mock IdP, echo upstream and the proxy
+func New(c Config) (*Harness, error) {
+	idp, err := oidctest.NewServer(c.Provider)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	h := &Harness{IdP: idp}
+	h.Upstream = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(Echo{Method: r.Method, Path: r.URL.Path, Header: r.Header})
+	}))
+
+	// proxy is built after listen because Authenticator fetches JWKS
+	var proxy atomic.Value
+	h.Proxy = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		proxy.Load().(http.Handler).ServeHTTP(w, r)
+	}))
+	u, err := url.Parse(h.Upstream.URL)
+	if err != nil {
+		h.Close()
+		return nil, errors.WithStack(err)
+	}
+	build := c.Build
+	if build == nil {
+		build = func(e Env) (http.Handler, error) {
+			return defaultBuild(e, c.Headers, c.Options)
+		}
+	}
+	ph, err := build(Env{OIDC: idp.OIDCConfig("/cb"), Upstream: u})
+	if err != nil {
+		h.Close()
+		return nil, errors.WithStack(err)
+	}
+	proxy.Store(ph)
+
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		h.Close()
+		return nil, errors.WithStack(err)
+	}
+	h.Client = &http.Client{
+		Jar: jar,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+	return h, nil
+}
+
+// Close stops all servers
+func (h *Harness) Close() {
+	h.Proxy.Close()
+	h.Upstream.Close()
+	h.IdP.Close()
+}
+
+// Get requests path of the proxy
+func (h *Harness) Get(path string) (*http.Response, error) {
+	res, err := h.Client.Get(h.Proxy.URL + path)
+	return res, errors.WithStack(err)
+}
+
+// Login runs "/login", authorize of IdP and form_post callback.
+// It returns response of the callback.
+func (h *Harness) Login() (*http.Response, error) {
+	form, action, err := h.Authorize()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	return h.Callback(action, form)
+}
+
+// Authorize follows "/login" to IdP and returns form_post values and action
+func (h *Harness) Authorize() (url.Values, string, error) {
+	res, err := h.Get("/login")
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusFound {
+		return nil, "", errors.Errorf("login responds %d", res.StatusCode)
+	}
+	res, err = h.Client.Get(res.Header.Get("Location"))
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, "", errors.Errorf("authorize responds %d", res.StatusCode)
+	}
+	return ParseFormPost(res)
+}
+
+// Callback posts form to action like a browser
+func (h *Harness) Callback(action string, form url.Values) (*http.Response, error) {
+	req, err := http.NewRequest("POST", action, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Origin", h.IdP.URL)
+	res, err := h.Client.Do(req)
+	return res, errors.WithStack(err)
+}
+
+// Logout posts "/logout" like a form of the proxy
+func (h *Harness) Logout() (*http.Response, error) {
+	req, err := http.NewRequest("POST", h.Proxy.URL+"/logout", nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	req.Header.Set("Origin", h.Proxy.URL)
+	res, err := h.Client.Do(req)
+	return res, errors.WithStack(err)
+}
+
+// GetEcho requests path with header and decodes request which upstream received
+func (h *Harness) GetEcho(path string, header http.Header) (*Echo, error) {
+	req, err := http.NewRequest("GET", h.Proxy.URL+path, nil)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	for k, v := range header {
+		req.Header[k] = v
+	}
+	res, err := h.Client.Do(req)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, errors.Errorf("%s responds %d", path, res.StatusCode)
+	}
+	var e Echo
+	return &e, errors.WithStack(json.NewDecoder(res.Body).Decode(&e))
+}
+
+var (
+	reFormAction = regexp.MustCompile(`<form method="post" action="([^"]+)"`)
+	reFormInput  = regexp.MustCompile(`<input type="hidden" name="([^"]+)" value="([^"]*)"`)
+)
+
+// ParseFormPost extracts values of form_post response of oidctest
+func ParseFormPost(res *http.Response) (url.Values, string, error) {
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil {
+		return nil, "", errors.WithStack(err)
+	}
+	m := reFormAction.FindSubmatch(b)
+	if m == nil {
+		return nil, "", errors.Errorf("form is not found")
+	}
+	action := unescape(string(m[1]))
+	form := url.Values{}
+	for _, v := range reFormInput.FindAllSubmatch(b, -1) {
+		form.Set(string(v[1]), unescape(string(v[2])))
+	}
+	return form, action, nil
+}
+
+// unescape decodes entities which html/template escapes in attributes
+func unescape(s string) string {
+	r := strings.NewReplacer("&amp;", "&", "&#43;", "+", "&#34;", `"`, "&#39;", "'", "&lt;", "<", "&gt;", ">")
+	return r.Replace(s)
+}
+
+// defaultBuild builds standard stack of router package
+func defaultBuild(e Env, headers []router.AdditionalHeader, opts []router.Option) (http.Handler, error) {
+	auth, err := oidc.NewAuthenticator(&e.OIDC)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	store := memstore.NewMemStore([]byte("routertest-authkey"))
+	aikey := &contextKey{"authinfo"}
+	as := session.NewAuthStore(store, "authproxy", aikey)
+	ep, err := errorpage.NewErrorPages()
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+	if headers == nil {
+		headers = []router.AdditionalHeader{
+			{ClaimKey: "preferred_username", HeaderName: "X-Username"},
+		}
+	}
+	opts = append([]router.Option{router.CallbackPath(e.OIDC.RedirectURL)}, opts...)
+	rp := router.New(auth, as, ep, aikey, opts...)
+	rph, err := rp.ReverseProxy(e.Upstream, headers)
+	if err != nil {
+		return nil, errors.WithStack(err)
+	}
+
+	r := chi.NewRouter()
+	r.NotFound(func(w http.ResponseWriter, r *http.Request) {
+		ep.Error(w, r, fmt.Sprintf("Not found path: [%s]", r.URL.Path), 404)
+	})
+	r.Use(rp.ResolveClient())
+	r.Use(rp.StripHeaders())
+	r.Use(rp.LoadSession())
+	r.Method("POST", "/cb", rp.Authenticate())
+	r.Method("GET", "/login", rp.Login(router.ReferrerMatch(regexp.MustCompile(`^https?://(127\.0\.0\.1|localhost)`))))
+	r.Method("POST", "/logout", rp.Logout())
+	r.Method("GET", "/.auth/me", rp.Me(router.MeConfig{}))
+	r.Handle("/public/*", rph)
+	r.Route("/", func(r chi.Router) {
+		r.Use(rp.AuthRedirect())
+		r.Handle("/*", rph)
+	})
+	return r, nil
+}
+
+type contextKey struct {
+	name string
+}
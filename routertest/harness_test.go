@@ -0,0 +1,141 @@
+package routertest_test
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/oidctest"
+	"github.com/uzuna/go-authproxy/router"
+	"github.com/uzuna/go-authproxy/routertest"
+)
+
+func newHarness(t *testing.T, opts ...router.Option) *routertest.Harness {
+	h, err := routertest.New(routertest.Config{
+		Options: opts,
+		Provider: oidctest.Config{
+			Claims: map[string]interface{}{
+				"sub":                "alice",
+				"preferred_username": "alice@example.com",
+			},
+		},
+	})
+	checkError(t, err)
+	return h
+}
+
+func TestLoginFlow(t *testing.T) {
+	h := newHarness(t)
+	defer h.Close()
+
+	// unauthenticated access prompts login
+	res, err := h.Get("/private")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	// login redirects to the provider with form_post
+	res, err = h.Get("/login")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusFound, res.StatusCode)
+	loc := res.Header.Get("Location")
+	assert.True(t, strings.HasPrefix(loc, h.IdP.URL+oidctest.AuthorizePath), loc)
+	assert.Contains(t, loc, "response_mode=form_post")
+
+	// form_post callback logs in
+	res, err = h.Login()
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+
+	// proxied request has identity headers
+	e, err := h.GetEcho("/private/path", nil)
+	checkError(t, err)
+	assert.Equal(t, "GET", e.Method)
+	assert.Equal(t, "/private/path", e.Path)
+	assert.Equal(t, "alice@example.com", e.Header.Get("X-Username"))
+	assert.True(t, strings.HasPrefix(e.Header.Get("Authorization"), "Bearer "))
+
+	// spoofed identity header is replaced
+	e, err = h.GetEcho("/private", http.Header{"X-Username": {"mallory"}})
+	checkError(t, err)
+	assert.Equal(t, "alice@example.com", e.Header.Get("X-Username"))
+
+	// logout
+	res, err = h.Logout()
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+	res, err = h.Get("/private")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestExpiry(t *testing.T) {
+	h := newHarness(t, router.Leeway(time.Second))
+	defer h.Close()
+	h.IdP.SetModify(func(claims map[string]interface{}) {
+		claims["exp"] = time.Now().Add(time.Second).Unix()
+	})
+
+	res, err := h.Login()
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+	_, err = h.GetEcho("/private", nil)
+	checkError(t, err)
+
+	// leeway allows 1s of clock difference
+	time.Sleep(time.Millisecond * 2100)
+	res, err = h.Get("/private")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestReplayedState(t *testing.T) {
+	h := newHarness(t)
+	defer h.Close()
+
+	form, action, err := h.Authorize()
+	checkError(t, err)
+	res, err := h.Callback(action, form)
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusSeeOther, res.StatusCode)
+
+	// state is consumed by the first callback
+	res, err = h.Callback(action, form)
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func TestWrongAudience(t *testing.T) {
+	h := newHarness(t)
+	defer h.Close()
+	h.IdP.SetModify(func(claims map[string]interface{}) {
+		claims["aud"] = "other-client"
+	})
+
+	res, err := h.Login()
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+
+	res, err = h.Get("/private")
+	checkError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusUnauthorized, res.StatusCode)
+}
+
+func checkError(t *testing.T, err error) {
+	if err != nil {
+		t.Logf("%+v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,157 @@
+// Package secret resolves secrets from references in config
+// and keeps them out of logs and dumps.
+package secret
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+
+	"github.com/pkg/errors"
+)
+
+// Redacted is printed instead of secret
+const Redacted = "[REDACTED]"
+
+// Scheme of reference
+const (
+	SchemeFile = "file:"
+	SchemeEnv  = "env:"
+	SchemeExec = "exec:"
+)
+
+// Value is secret string. fmt, json and yaml print it as Redacted.
+// Use string(v) to get the value.
+type Value string
+
+func (v Value) String() string {
+	if len(v) < 1 {
+		return ""
+	}
+	return Redacted
+}
+
+// GoString redacts %#v
+func (v Value) GoString() string {
+	return `secret.Value("` + v.String() + `")`
+}
+
+// MarshalJSON redacts the value
+func (v Value) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.String())
+}
+
+// MarshalYAML redacts the value
+func (v Value) MarshalYAML() (interface{}, error) {
+	return v.String(), nil
+}
+
+// IsRef reports s is reference of secret
+func IsRef(s string) bool {
+	for _, v := range []string{SchemeFile, SchemeEnv, SchemeExec} {
+		if strings.HasPrefix(s, v) {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve returns secret of reference.
+//
+//	file:/run/secrets/x      content of the file
+//	env:NAME                 environment variable
+//	exec:/path/helper args   stdout of the command. e.g. vault-style helper
+//
+// Arguments of exec are separated by spaces. Single or double quotes keep spaces
+// and backslash escapes the next character like shell. stderr of the command is
+// not printed because it may contain the secret.
+//
+// Other string is returned as literal secret.
+// Trailing newline is trimmed. Errors never contain the secret.
+func Resolve(ctx context.Context, ref string) (Value, error) {
+	switch {
+	case strings.HasPrefix(ref, SchemeFile):
+		path := strings.TrimPrefix(ref, SchemeFile)
+		b, err := ioutil.ReadFile(path)
+		if err != nil {
+			return "", errors.WithStack(err)
+		}
+		return trim(b), nil
+	case strings.HasPrefix(ref, SchemeEnv):
+		name := strings.TrimPrefix(ref, SchemeEnv)
+		v, ok := os.LookupEnv(name)
+		if !ok {
+			return "", errors.Errorf("Environment variable [%s] is not set", name)
+		}
+		return Value(v), nil
+	case strings.HasPrefix(ref, SchemeExec):
+		args, err := splitArgs(strings.TrimPrefix(ref, SchemeExec))
+		if err != nil {
+			return "", err
+		}
+		if len(args) < 1 {
+			return "", errors.Errorf("Command is empty")
+		}
+		var stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+		cmd.Stderr = &stderr
+		b, err := cmd.Output()
+		if err != nil {
+			return "", errors.Wrapf(err, "Fail exec [%s]. %d bytes of stderr are hidden", args[0], stderr.Len())
+		}
+		return trim(b), nil
+	}
+	return Value(ref), nil
+}
+
+func trim(b []byte) Value {
+	return Value(bytes.TrimRight(b, "\r\n"))
+}
+
+// splitArgs splits command line by spaces except in quotes
+func splitArgs(s string) ([]string, error) {
+	var (
+		args  []string
+		buf   strings.Builder
+		quote rune
+		arg   bool
+		esc   bool
+	)
+	for _, c := range s {
+		switch {
+		case esc:
+			buf.WriteRune(c)
+			esc = false
+		case c == '\\' && quote != '\'':
+			esc, arg = true, true
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			} else {
+				buf.WriteRune(c)
+			}
+		case c == '\'' || c == '"':
+			quote, arg = c, true
+		case c == ' ' || c == '\t':
+			if arg {
+				args = append(args, buf.String())
+				buf.Reset()
+				arg = false
+			}
+		default:
+			buf.WriteRune(c)
+			arg = true
+		}
+	}
+	if quote != 0 || esc {
+		return nil, errors.Errorf("Unterminated quote or escape in command")
+	}
+	if arg {
+		args = append(args, buf.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,93 @@
+package secret_test
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/secret"
+	"gopkg.in/yaml.v2"
+)
+
+func TestRedact(t *testing.T) {
+	v := struct {
+		Secret secret.Value `json:"secret" yaml:"secret"`
+		Empty  secret.Value `json:"empty" yaml:"empty"`
+	}{Secret: "s3cret"}
+
+	for _, s := range []string{
+		fmt.Sprintf("%s", v.Secret),
+		fmt.Sprintf("%v", v),
+		fmt.Sprintf("%+v", v),
+		fmt.Sprintf("%#v", v),
+		fmt.Sprintf("%q", v.Secret),
+	} {
+		assert.NotContains(t, s, "s3cret")
+		assert.Contains(t, s, secret.Redacted)
+	}
+	b, err := json.Marshal(v)
+	checkError(t, err)
+	assert.Equal(t, `{"secret":"[REDACTED]","empty":""}`, string(b))
+	b, err = yaml.Marshal(v)
+	checkError(t, err)
+	assert.Equal(t, "secret: '[REDACTED]'\nempty: \"\"\n", string(b))
+	assert.Equal(t, "s3cret", string(v.Secret))
+}
+
+func TestResolve(t *testing.T) {
+	f, err := ioutil.TempFile("", "secret")
+	checkError(t, err)
+	defer os.Remove(f.Name())
+	f.WriteString("from-file\n")
+	f.Close()
+	os.Setenv("TEST_SECRET_VALUE", "from-env")
+	defer os.Unsetenv("TEST_SECRET_VALUE")
+
+	ctx := context.Background()
+	testset := []struct {
+		ref    string
+		expect secret.Value
+	}{
+		{"literal", "literal"},
+		{"file:" + f.Name(), "from-file"},
+		{"env:TEST_SECRET_VALUE", "from-env"},
+		{"exec:echo from-exec", "from-exec"},
+		{`exec:printf %s "two  words"`, "two  words"},
+		{`exec:printf %s 'a "b"' c\ d`, `a "b"c d`},
+	}
+	for _, v := range testset {
+		s, err := secret.Resolve(ctx, v.ref)
+		checkError(t, err)
+		assert.Equal(t, v.expect, s, v.ref)
+	}
+
+	for _, ref := range []string{
+		"file:/not/exist",
+		"env:TEST_SECRET_NOT_SET",
+		"exec:false",
+		"exec:",
+		`exec:echo "unterminated`,
+	} {
+		_, err := secret.Resolve(ctx, ref)
+		assert.Error(t, err, ref)
+	}
+
+	// stderr of the helper is not shown
+	_, err = secret.Resolve(ctx, `exec:sh -c "echo leaked-s3cret >&2; exit 1"`)
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "leaked-s3cret")
+	assert.Contains(t, err.Error(), "14 bytes of stderr are hidden")
+	assert.True(t, secret.IsRef("exec:echo"))
+	assert.False(t, secret.IsRef("literal"))
+}
+
+func checkError(t *testing.T, err error) {
+	if err != nil {
+		t.Logf("%+v", err)
+		t.FailNow()
+	}
+}
@@ -0,0 +1,227 @@
+// Package tracing records spans of login, callback and proxy hops by OpenTelemetry
+// and propagates W3C traceparent to upstreams.
+package tracing
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"os"
+
+	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "github.com/uzuna/go-authproxy"
+
+	// ExporterOTLPHTTP exports spans by OTLP over HTTP
+	ExporterOTLPHTTP = "otlphttp"
+	// ExporterStdout writes spans to stdout
+	ExporterStdout = "stdout"
+	// ExporterFile writes spans to file
+	ExporterFile = "file"
+)
+
+// Config is setting of trace exporter
+type Config struct {
+	// Exporter is one of "", "otlphttp", "stdout" or "file".
+	// Tracing is disabled when empty.
+	Exporter string `json:"exporter" yaml:"exporter"`
+	// Endpoint is host:port of OTLP collector. e.g. "localhost:4318"
+	Endpoint string `json:"endpoint" yaml:"endpoint"`
+	// URLPath of OTLP traces. default is "/v1/traces"
+	URLPath  string `json:"url_path" yaml:"url_path"`
+	Insecure bool   `json:"insecure" yaml:"insecure"`
+	// File is output path of "file" exporter
+	File        string  `json:"file" yaml:"file"`
+	ServiceName string  `json:"service_name" yaml:"service_name"`
+	SampleRatio float64 `json:"sample_ratio" yaml:"sample_ratio"`
+}
+
+// Setup installs global TracerProvider and W3C trace context propagator.
+// Returned func flushes and stops the exporter.
+func Setup(c Config) (func(context.Context) error, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+	if len(c.Exporter) < 1 {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	var exp sdktrace.SpanExporter
+	var closer io.Closer
+	switch c.Exporter {
+	case ExporterOTLPHTTP:
+		opts := []otlptracehttp.Option{}
+		if len(c.Endpoint) > 0 {
+			opts = append(opts, otlptracehttp.WithEndpoint(c.Endpoint))
+		}
+		if len(c.URLPath) > 0 {
+			opts = append(opts, otlptracehttp.WithURLPath(c.URLPath))
+		}
+		if c.Insecure {
+			opts = append(opts, otlptracehttp.WithInsecure())
+		}
+		x, err := otlptracehttp.New(context.Background(), opts...)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		exp = x
+	case ExporterStdout:
+		x, err := stdouttrace.New(stdouttrace.WithWriter(os.Stdout))
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		exp = x
+	case ExporterFile:
+		f, err := os.OpenFile(c.File, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return nil, errors.WithStack(err)
+		}
+		x, err := stdouttrace.New(stdouttrace.WithWriter(f))
+		if err != nil {
+			f.Close()
+			return nil, errors.WithStack(err)
+		}
+		exp, closer = x, f
+	default:
+		return nil, errors.Errorf("Unknown trace exporter [%s]", c.Exporter)
+	}
+
+	name := c.ServiceName
+	if len(name) < 1 {
+		name = "authproxy"
+	}
+	sampler := sdktrace.AlwaysSample()
+	if c.SampleRatio > 0 && c.SampleRatio < 1 {
+		sampler = sdktrace.TraceIDRatioBased(c.SampleRatio)
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exp),
+		sdktrace.WithSampler(sdktrace.ParentBased(sampler)),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL,
+			semconv.ServiceNameKey.String(name),
+		)),
+	)
+	otel.SetTracerProvider(tp)
+
+	return func(ctx context.Context) error {
+		err := tp.Shutdown(ctx)
+		if closer != nil {
+			closer.Close()
+		}
+		return errors.WithStack(err)
+	}, nil
+}
+
+// Start creates span as child of the span in ctx
+func Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, opts...)
+}
+
+// End records error to the span and ends it
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// TraceID returns trace id of the span in ctx.
+// It returns empty string when there is no valid span.
+func TraceID(ctx context.Context) string {
+	sc := trace.SpanContextFromContext(ctx)
+	if !sc.HasTraceID() {
+		return ""
+	}
+	return sc.TraceID().String()
+}
+
+// Middleware starts server span of the request named name.
+// traceparent of incoming request is used as parent.
+func Middleware(name string) func(next http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		fn := func(w http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+			ctx, span := Start(ctx, name,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("", r.URL.Path, r)...),
+			)
+			defer span.End()
+			sw := &statusWriter{ResponseWriter: w, code: http.StatusOK}
+			next.ServeHTTP(sw, r.WithContext(ctx))
+			span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(sw.code)...)
+			span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(sw.code))
+		}
+		return http.HandlerFunc(fn)
+	}
+}
+
+// Transport records client span of upstream round trip
+// and injects traceparent to outgoing request.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	if base == nil {
+		base = http.DefaultTransport
+	}
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, span := Start(req.Context(), "upstream "+req.URL.Host,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(semconv.HTTPClientAttributesFromHTTPRequest(req)...),
+	)
+	defer span.End()
+	req = req.WithContext(ctx)
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	res, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+		return res, err
+	}
+	span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(res.StatusCode)...)
+	span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(res.StatusCode))
+	return res, nil
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	w.code = code
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is required by ReverseProxy to upgrade connection
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.Errorf("ResponseWriter does not implement http.Hijacker")
+	}
+	return h.Hijack()
+}
@@ -0,0 +1,60 @@
+package tracing_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/uzuna/go-authproxy/tracing"
+	"go.opentelemetry.io/otel"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+func TestPropagation(t *testing.T) {
+	_, err := tracing.Setup(tracing.Config{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sr := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(sr)))
+	defer otel.SetTracerProvider(sdktrace.NewTracerProvider())
+
+	var traceparent string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceparent = r.Header.Get("traceparent")
+	}))
+	defer upstream.Close()
+
+	var traceID string
+	client := &http.Client{Transport: tracing.Transport(nil)}
+	h := tracing.Middleware("test")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		traceID = tracing.TraceID(r.Context())
+		req, _ := http.NewRequest("GET", upstream.URL, nil)
+		res, err := client.Do(req.WithContext(r.Context()))
+		if err != nil {
+			t.Fatal(err)
+		}
+		res.Body.Close()
+	}))
+
+	// incoming traceparent is continued
+	parent := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("traceparent", parent)
+	h.ServeHTTP(httptest.NewRecorder(), req)
+
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", traceID)
+	assert.True(t, strings.HasPrefix(traceparent, "00-"+traceID+"-"), traceparent)
+	assert.NotEqual(t, parent, traceparent)
+	assert.Len(t, sr.Ended(), 2)
+	assert.Equal(t, "", tracing.TraceID(context.Background()))
+}
+
+func TestSetupUnknownExporter(t *testing.T) {
+	_, err := tracing.Setup(tracing.Config{Exporter: "zipkin"})
+	assert.Error(t, err)
+}